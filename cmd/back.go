@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/joho/godotenv"
@@ -14,6 +18,8 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+var backWaitTimeout time.Duration
+
 // serveCmd represents the serve command
 var backforthCmd = &cobra.Command{
 	Use:   "back",
@@ -23,7 +29,7 @@ var backforthCmd = &cobra.Command{
 		logger := log.New(os.Stderr).WithColor()
 		logger.Info("backd-and-forth command called")
 
-		ctx, cancel := context.WithCancel(context.Background())
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 		defer cancel()
 
 		kubeconfigPath := os.Getenv("KUBECONFIG")
@@ -68,10 +74,16 @@ var backforthCmd = &cobra.Command{
 		}
 		defer db.Close(ctx)
 
-		pkg.GetBackLatency(ctx, clientset, namespace, db, numContainers, logger)
+		err = pkg.GetBackLatency(ctx, clientset, namespace, db, numContainers, backWaitTimeout, logger)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error(err)
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(backforthCmd)
+
+	backforthCmd.Flags().DurationVar(&backWaitTimeout, "wait-timeout", pkg.DefaultWaitTimeout, "how long to wait for a migration before giving up")
 }
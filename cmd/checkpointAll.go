@@ -3,7 +3,6 @@ package cmd
 import (
 	"context"
 	"os"
-	"os/exec"
 	"strings"
 
 	"github.com/leonardopoggiani/live-migration-operator/controllers"
@@ -86,7 +85,5 @@ var checkpointAllCmd = &cobra.Command{
 }
 
 func init() {
-	exec.Command("sudo", "rm", "-rf", "/tmp/checkpoints/checkpoints")
-	exec.Command("sudo", "mkdir", "/tmp/checkpoints/checkpoints")
 	rootCmd.AddCommand(checkpointAllCmd)
 }
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/joho/godotenv"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/consistency"
+	"github.com/spf13/cobra"
+	"github.com/withmandala/go-log"
+)
+
+var (
+	consistencyAddress  string
+	consistencyWrites   int
+	consistencySnapshot string
+	consistencyTimeout  time.Duration
+)
+
+var consistencyCmd = &cobra.Command{
+	Use:       "consistency prepare|verify",
+	Short:     "Verify that the application state survives a migration",
+	ValidArgs: []string{"prepare", "verify"},
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	Long: `Check the in-memory state of the stateful app (statefulapp/) across a migration.
+prepare writes --writes values to the app and saves a snapshot of its state to --snapshot;
+run it before the migration. verify, run after the restore, compares the app with the
+snapshot: writes missing from its history are lost, and a different boot ID means the
+process was started again rather than restored. The outcome is stored in consistency_checks
+and the command exits with status 1 when the state is not intact.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := log.New(os.Stderr).WithColor()
+		logger.Info("consistency command called")
+
+		godotenv.Load(".env")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		address := consistencyAddress
+		if address == "" {
+			address = os.Getenv("STATEFUL_APP_ADDRESS")
+		}
+		if address == "" {
+			logger.Error("No address given, set --address or STATEFUL_APP_ADDRESS")
+			os.Exit(1)
+		}
+
+		client := consistency.NewClient(address, consistencyTimeout)
+
+		if args[0] == "prepare" {
+			snapshot, err := consistency.Prepare(ctx, client, address, consistencyWrites)
+			if err != nil {
+				logger.Errorf("Unable to prepare the app: %v", err)
+				os.Exit(1)
+			}
+
+			if err := consistency.SaveSnapshot(consistencySnapshot, snapshot); err != nil {
+				logger.Errorf("Unable to save the snapshot: %v", err)
+				os.Exit(1)
+			}
+
+			logger.Infof("Wrote %d values, boot ID %s, counter %d, snapshot saved to %s",
+				len(snapshot.Writes), snapshot.State.BootID, snapshot.State.Counter, consistencySnapshot)
+			return
+		}
+
+		snapshot, err := consistency.LoadSnapshot(consistencySnapshot)
+		if err != nil {
+			logger.Errorf("Unable to load the snapshot: %v", err)
+			os.Exit(1)
+		}
+
+		numContainers, err := strconv.Atoi(os.Getenv("NUM_CONTAINERS"))
+		if err != nil {
+			numContainers = 1
+		}
+
+		db, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+		if err != nil {
+			logger.Errorf("Unable to connect to database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close(ctx)
+
+		check, err := consistency.Verify(ctx, client, snapshot)
+		consistency.SaveCheckToDB(ctx, db, numContainers, check, err)
+		if err != nil {
+			logger.Errorf("Unable to verify the app: %v", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("same process: %t (boot ID %s -> %s)\n", check.SameProcess, check.Before.BootID, check.After.BootID)
+		fmt.Printf("lost writes: %d of %d\n", check.LostWrites, check.Writes)
+		fmt.Printf("history checksum: %t (%s -> %s)\n", check.ChecksumMatch, check.Before.Checksum, check.After.Checksum)
+		fmt.Printf("counter: %d -> %d\n", check.CounterBefore, check.CounterAfter)
+
+		if !check.Intact() {
+			logger.Error("Application state did not survive the migration")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	consistencyCmd.Flags().StringVar(&consistencyAddress, "address", "", "address of the stateful app (default $STATEFUL_APP_ADDRESS)")
+	consistencyCmd.Flags().IntVar(&consistencyWrites, "writes", 100, "number of values written by prepare")
+	consistencyCmd.Flags().StringVar(&consistencySnapshot, "snapshot", "consistency-snapshot.json", "file holding the state taken by prepare")
+	consistencyCmd.Flags().DurationVar(&consistencyTimeout, "timeout", 5*time.Second, "timeout of a single request to the app")
+	rootCmd.AddCommand(consistencyCmd)
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/joho/godotenv"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/latency"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/report"
+	"github.com/spf13/cobra"
+	"github.com/withmandala/go-log"
+)
+
+var (
+	downtimeRun    string
+	downtimeSince  string
+	downtimeUntil  string
+	downtimeTarget string
+	downtimeMargin time.Duration
+)
+
+var downtimeCmd = &cobra.Command{
+	Use:   "downtime",
+	Short: "Compute the service downtime of every migration",
+	Long: `Align the probe attempts recorded by the latency command, run with --store raw or
+--store both, with the migration start (start_times) and restore end (back_and_forth_times)
+of every trial, and report the downtime window, the failed requests, the time to the first success after the restore
+and the latency inflation before and after the migration.
+The downtime is reported per target and, when several targets were probed, combined over
+all of them.
+The restore end is read from the receiver clock: when the sender measured the offset of
+that clock (clock_offsets), the end is moved to the sender clock and the applied correction
+is printed with its uncertainty.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := log.New(os.Stderr).WithColor()
+		logger.Info("downtime command called")
+
+		godotenv.Load(".env")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		db, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+		if err != nil {
+			logger.Errorf("Unable to connect to database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close(ctx)
+
+		since, until := time.Unix(0, 0), time.Now()
+		if downtimeRun != "" {
+			run, err := report.LoadRun(ctx, db, downtimeRun)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			since, until = run.Window()
+		}
+
+		if downtimeSince != "" {
+			if since, err = time.Parse(time.RFC3339, downtimeSince); err != nil {
+				logger.Errorf("Invalid --since: %v", err)
+				os.Exit(1)
+			}
+		}
+
+		if downtimeUntil != "" {
+			if until, err = time.Parse(time.RFC3339, downtimeUntil); err != nil {
+				logger.Errorf("Invalid --until: %v", err)
+				os.Exit(1)
+			}
+		}
+
+		windows, err := latency.LoadMigrationWindows(ctx, db, since, until)
+		if err != nil {
+			logger.Errorf("Unable to load migrations: %v", err)
+			os.Exit(1)
+		}
+
+		samples, err := latency.LoadProbes(ctx, db, since.Add(-downtimeMargin), until.Add(downtimeMargin))
+		if err != nil {
+			logger.Errorf("Unable to load probes: %v", err)
+			os.Exit(1)
+		}
+
+		if downtimeTarget != "" {
+			filtered := samples[:0]
+			for _, sample := range samples {
+				if sample.Target == downtimeTarget {
+					filtered = append(filtered, sample)
+				}
+			}
+			samples = filtered
+		}
+
+		targets := latency.ComputeTargetDowntimes(samples, windows, downtimeMargin)
+		latency.WriteTargetDowntimes(os.Stdout, targets)
+	},
+}
+
+func init() {
+	downtimeCmd.Flags().StringVar(&downtimeRun, "run", "", "analyse the migrations of the given run ID")
+	downtimeCmd.Flags().StringVar(&downtimeSince, "since", "", "analyse the migrations started after this time (RFC 3339)")
+	downtimeCmd.Flags().StringVar(&downtimeUntil, "until", "", "analyse the migrations started before this time (RFC 3339)")
+	downtimeCmd.Flags().StringVar(&downtimeTarget, "target", "", "only use the probes of this target")
+	downtimeCmd.Flags().DurationVar(&downtimeMargin, "margin", 30*time.Second, "time around the migration used for the latency baseline and recovery")
+	rootCmd.AddCommand(downtimeCmd)
+}
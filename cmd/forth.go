@@ -2,8 +2,12 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/joho/godotenv"
@@ -14,6 +18,8 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+var forthWaitTimeout time.Duration
+
 // serveCmd represents the serve command
 var forthCmd = &cobra.Command{
 	Use:   "forth",
@@ -23,7 +29,7 @@ var forthCmd = &cobra.Command{
 		logger := log.New(os.Stderr).WithColor()
 		logger.Info("backd-and-forth command called")
 
-		ctx, cancel := context.WithCancel(context.Background())
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 		defer cancel()
 
 		kubeconfigPath := os.Getenv("KUBECONFIG")
@@ -68,10 +74,16 @@ var forthCmd = &cobra.Command{
 		}
 		defer db.Close(ctx)
 
-		pkg.GetForthLatency(ctx, clientset, namespace, db, numContainers, logger)
+		err = pkg.GetForthLatency(ctx, clientset, namespace, db, numContainers, forthWaitTimeout, logger)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error(err)
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(forthCmd)
+
+	forthCmd.Flags().DurationVar(&forthWaitTimeout, "wait-timeout", pkg.DefaultWaitTimeout, "how long to wait for a migration before giving up")
 }
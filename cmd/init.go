@@ -31,13 +31,36 @@ var initCmd = &cobra.Command{
 		defer db.Close(ctx)
 
 		pkg.CreateTable(ctx, db, "checkpoint_times", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, containers INTEGER, elapsed FLOAT, checkpoint_type TEXT")
+		pkg.CreateTable(ctx, db, "checkpoint_sizes", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, containers INTEGER, size FLOAT, checkpoint_type TEXT, migration_id TEXT")
 		pkg.CreateTable(ctx, db, "restore_times", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, containers INTEGER, elapsed FLOAT, checkpoint_type TEXT")
-		pkg.CreateTable(ctx, db, "total_times", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, containers INTEGER, elapsed FLOAT, checkpoint_type TEXT")
+		pkg.CreateTable(ctx, db, "total_times", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, containers INTEGER, elapsed FLOAT, checkpoint_type TEXT, migration_id TEXT, restore_strategy TEXT")
 		pkg.CreateTable(ctx, db, "triangularized_times", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, containers INTEGER, elapsed FLOAT, checkpoint_type TEXT")
-		pkg.CreateTable(ctx, db, "start_times", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, containers INTEGER, elapsed FLOAT, checkpoint_type TEXT")
+		pkg.CreateTable(ctx, db, "start_times", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, containers INTEGER, elapsed FLOAT, checkpoint_type TEXT, migration_id TEXT")
 		pkg.CreateTable(ctx, db, "end_times", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, containers INTEGER, elapsed FLOAT, checkpoint_type TEXT")
-		pkg.CreateTable(ctx, db, "latency", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, containers INTEGER, elapsed FLOAT, checkpoint_type TEXT")
-		pkg.CreateTable(ctx, db, "back_and_forth_times", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, containers INTEGER, elapsed FLOAT, checkpoint_type TEXT")
+		pkg.CreateTable(ctx, db, "latency", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, containers INTEGER, elapsed FLOAT, checkpoint_type TEXT, target TEXT")
+		pkg.CreateTable(ctx, db, "back_and_forth_times", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, containers INTEGER, elapsed FLOAT, checkpoint_type TEXT, migration_id TEXT")
+		pkg.CreateTable(ctx, db, "latency_probes", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, scheduled TIMESTAMPTZ, target TEXT, containers INTEGER, status INTEGER, error_class TEXT, error TEXT, dns FLOAT, connect FLOAT, ttfb FLOAT, total FLOAT")
+		pkg.CreateTable(ctx, db, "latency_histograms", "timestamp TIMESTAMPTZ, duration FLOAT, target TEXT, containers INTEGER, phase TEXT, count BIGINT, failures BIGINT, histogram BYTEA")
+		pkg.CreateTable(ctx, db, "consistency_checks", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, target TEXT, containers INTEGER, same_process BOOLEAN, boot_id_before TEXT, boot_id_after TEXT, writes INTEGER, lost_writes INTEGER, checksum_match BOOLEAN, counter_before BIGINT, counter_after BIGINT, intact BOOLEAN, error TEXT")
+		pkg.CreateTable(ctx, db, "clock_offsets", "timestamp TIMESTAMPTZ, migration_id TEXT, clock_offset FLOAT, uncertainty FLOAT, round_trip FLOAT, samples INTEGER")
+		pkg.CreateTable(ctx, db, "migration_phases", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, migration_id TEXT, host TEXT, seq INTEGER, phase TEXT, started TIMESTAMPTZ, finished TIMESTAMPTZ, error TEXT")
+		pkg.CreateTable(ctx, db, "transfers", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, migration_id TEXT, transport TEXT, link TEXT, link_rate FLOAT, files INTEGER, bytes BIGINT, elapsed FLOAT, throughput FLOAT")
+		pkg.CreateTable(ctx, db, "compressions", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, migration_id TEXT, codec TEXT, level INTEGER, files INTEGER, raw_bytes BIGINT, compressed_bytes BIGINT, ratio FLOAT, compression_time FLOAT, decompression_time FLOAT")
+		pkg.CreateTable(ctx, db, "runs", "id TEXT PRIMARY KEY, kind TEXT, started TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, finished TIMESTAMPTZ, fingerprint JSONB")
+		pkg.CreateTable(ctx, db, "failed_trials", "timestamp TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, migration_id TEXT, containers INTEGER, checkpoint_type TEXT, phase TEXT, error_class TEXT, error TEXT")
+
+		// Tables created before migration IDs were introduced.
+		for _, table := range []string{"total_times", "start_times", "back_and_forth_times", "failed_trials", "checkpoint_sizes"} {
+			pkg.AddColumn(ctx, db, table, "migration_id TEXT")
+		}
+		pkg.AddColumn(ctx, db, "failed_trials", "error_class TEXT")
+		pkg.AddColumn(ctx, db, "total_times", "restore_strategy TEXT")
+		pkg.AddColumn(ctx, db, "consistency_checks", "checksum_match BOOLEAN")
+		pkg.AddColumn(ctx, db, "latency", "target TEXT")
+		pkg.AddColumn(ctx, db, "transfers", "link TEXT")
+		pkg.AddColumn(ctx, db, "transfers", "link_rate FLOAT")
+
+		pkg.RelabelCheckpointTotalTimes(ctx, db)
 	},
 }
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/joho/godotenv"
@@ -14,11 +15,35 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+var (
+	latencyService          string
+	latencyServiceNamespace string
+	latencyPort             string
+	latencyProbe            string
+	latencyTargets          string
+	latencyCreateService    bool
+	latencyOptions          latency.LoadOptions
+	latencyRecord           latency.RecordOptions
+	latencyTimeout          time.Duration
+)
+
 // serveCmd represents the serve command
 var latencyCmd = &cobra.Command{
 	Use:   "latency",
 	Short: "Execute the latency test",
-	Long:  `Make HTTP request to the pod during migration and record the latency.`,
+	Long: `Make HTTP request to the pod during migration and record the latency.
+The target address is resolved from the given Service (ClusterIP, or endpoints for headless
+Services) and resolved again whenever the Service is recreated.
+--probe selects the protocol: an HTTP HEAD request, a TCP connect, the MySQL handshake,
+a gRPC health check or a UDP echo; --port picks the matching port of the Service.
+With --targets, every target of the given YAML list (see back-and-forth/targets.yaml) is
+probed concurrently instead, each with its own probe type, and every sample is tagged with
+the name of its target.
+Requests are sent open-loop at a constant --rate, independent of the response times, so
+service interruptions during a migration are captured at millisecond resolution.
+By default the latencies are aggregated into HDR histograms per --histogram-interval,
+target and migration phase instead of one row per request; --store raw or --store both
+keeps a row per request, which the downtime command needs.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		logger := log.New(os.Stderr).WithColor()
 		logger.Info("latency command called")
@@ -69,10 +94,62 @@ var latencyCmd = &cobra.Command{
 		}
 		defer db.Close(ctx)
 
-		latency.GetLatency(ctx, clientset, namespace, db, numContainers, logger)
+		serviceNamespace := latencyServiceNamespace
+		if serviceNamespace == "" {
+			serviceNamespace = namespace
+		}
+
+		if latencyCreateService {
+			service, err := latency.CreateService(ctx, clientset, serviceNamespace)
+			if err != nil {
+				logger.Errorf("Unable to create service: %v", err)
+				return
+			}
+			latencyService = service.Name
+		}
+
+		if err := latencyOptions.Validate(); err != nil {
+			logger.Error(err.Error())
+			return
+		}
+
+		if err := latencyRecord.Validate(); err != nil {
+			logger.Error(err.Error())
+			return
+		}
+
+		specs := []latency.TargetSpec{{
+			Name:      latencyService,
+			Service:   latencyService,
+			Namespace: serviceNamespace,
+			Port:      latencyPort,
+			Probe:     latencyProbe,
+		}}
+		if latencyTargets != "" {
+			specs, err = latency.LoadTargets(latencyTargets, serviceNamespace)
+			if err != nil {
+				logger.Errorf("Unable to load targets: %v", err)
+				return
+			}
+		}
+
+		targets := latency.NewTargets(clientset, specs)
+		latency.GetLatency(ctx, targets, db, numContainers, latencyOptions, latencyRecord, latencyTimeout, logger)
 	},
 }
 
 func init() {
+	latencyCmd.Flags().StringVar(&latencyService, "service", "latency-test-svc", "name of the Service to probe")
+	latencyCmd.Flags().StringVar(&latencyServiceNamespace, "service-namespace", "", "namespace of the Service (default $NAMESPACE)")
+	latencyCmd.Flags().StringVar(&latencyPort, "port", "", "name or number of the Service port to probe (default the first one)")
+	latencyCmd.Flags().StringVar(&latencyProbe, "probe", latency.ProbeHTTP, "probe type: http, tcp, mysql, grpc or udp")
+	latencyCmd.Flags().StringVar(&latencyTargets, "targets", "", "YAML file listing several targets to probe concurrently")
+	latencyCmd.Flags().Float64Var(&latencyOptions.Rate, "rate", 100, "requests per second per target, sent regardless of the response times")
+	latencyCmd.Flags().IntVar(&latencyOptions.Concurrency, "concurrency", 50, "maximum number of requests in flight per target")
+	latencyCmd.Flags().DurationVar(&latencyOptions.Duration, "duration", 0, "how long to run, 0 runs until interrupted")
+	latencyCmd.Flags().DurationVar(&latencyTimeout, "timeout", time.Second, "timeout of a single request")
+	latencyCmd.Flags().StringVar(&latencyRecord.Store, "store", latency.StoreHDR, "how to store the attempts: raw, hdr or both")
+	latencyCmd.Flags().DurationVar(&latencyRecord.Interval, "histogram-interval", 10*time.Second, "time covered by every stored histogram")
+	latencyCmd.Flags().BoolVar(&latencyCreateService, "create-service", false, "create the Service from latency/latency-svc.yaml if missing")
 	rootCmd.AddCommand(latencyCmd)
 }
@@ -12,8 +12,11 @@ import (
 )
 
 var migrateCmd = &cobra.Command{
-	Use:   "migrate",
+	Use:   "migrate [trial]",
 	Short: "Migrate the given pod",
+	Long: `Migrate the checkpoint archives in $CHECKPOINTS_FOLDER, or in the directory of the
+given trial, e.g. one kept after a failure with $KEEP_FAILED_CHECKPOINTS.`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		logger := log.New(os.Stderr).WithColor()
 		logger.Info("migrate command called")
@@ -49,7 +52,7 @@ var migrateCmd = &cobra.Command{
 		namespace := os.Getenv("NAMESPACE")
 
 		reconciler := controllers.LiveMigrationReconciler{}
-		reconciler.MigrateCheckpoint(ctx, "/tmp/checkpoints/checkpoints", clientset, namespace)
+		reconciler.MigrateCheckpoint(ctx, checkpointDirectory(args), clientset, namespace)
 	},
 }
 
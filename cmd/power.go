@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/joho/godotenv"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/report"
+	"github.com/spf13/cobra"
+	"github.com/withmandala/go-log"
+)
+
+var (
+	powerTable      string
+	powerFirst      string
+	powerSecond     string
+	powerDifference float64
+	powerAlpha      float64
+	powerPower      float64
+	powerRun        string
+	powerWriteEnv   string
+)
+
+var powerCmd = &cobra.Command{
+	Use:   "power",
+	Short: "Estimate the repetitions needed to tell two strategies apart",
+	Long: `Use the pilot results stored in the database to estimate, for every container count,
+how many repetitions are needed to detect a difference of --difference milliseconds
+between two strategies with the given power and alpha.
+With --write-env the largest estimate is written as REPETITIONS into the given env file,
+which is read by the sender.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := log.New(os.Stderr).WithColor()
+		logger.Info("power command called")
+
+		godotenv.Load(".env")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		db, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+		if err != nil {
+			logger.Errorf("Unable to connect to database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close(ctx)
+
+		filter := report.Filter{RunID: powerRun}
+		if powerRun != "" {
+			run, err := report.LoadRun(ctx, db, powerRun)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			filter.Since, filter.Until = run.Window()
+		}
+
+		scenario, err := report.LoadScenario(ctx, db, powerTable, filter)
+		if err != nil {
+			logger.Errorf("Unable to load pilot data: %v", err)
+			os.Exit(1)
+		}
+
+		estimates, err := report.EstimatePower(*scenario, powerFirst, powerSecond, powerDifference, powerAlpha, powerPower)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		report.WritePower(os.Stdout, powerFirst, powerSecond, estimates)
+
+		repetitions := report.MaxRepetitions(estimates)
+		logger.Infof("%d repetitions per cell give %.0f%% power at alpha %.2f", repetitions, powerPower*100, powerAlpha)
+
+		if powerWriteEnv != "" {
+			if err := setEnvVariable(powerWriteEnv, "REPETITIONS", strconv.Itoa(repetitions)); err != nil {
+				logger.Errorf("Unable to write %s: %v", powerWriteEnv, err)
+				os.Exit(1)
+			}
+
+			logger.Infof("REPETITIONS=%d written to %s", repetitions, powerWriteEnv)
+		}
+	},
+}
+
+// setEnvVariable sets key to value in the env file at path, in place: the
+// lines assigning key are rewritten and every other line is kept as it is. The
+// assignment is appended when there is none, the file created when missing.
+func setEnvVariable(path string, key string, value string) error {
+	mode := os.FileMode(0644)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	assignment := regexp.MustCompile(`^(\s*(?:export\s+)?)` + regexp.QuoteMeta(key) + `\s*=`)
+
+	lines := strings.Split(string(data), "\n")
+	found := false
+	for i, line := range lines {
+		if match := assignment.FindStringSubmatch(line); match != nil {
+			lines[i] = match[1] + key + "=" + value
+			found = true
+		}
+	}
+
+	content := strings.Join(lines, "\n")
+	if !found {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		content += key + "=" + value + "\n"
+	}
+
+	return os.WriteFile(path, []byte(content), mode)
+}
+
+func init() {
+	powerCmd.Flags().StringVar(&powerTable, "table", "checkpoint_times", "table holding the pilot results")
+	powerCmd.Flags().StringVar(&powerFirst, "first", "pipelined", "first strategy to compare")
+	powerCmd.Flags().StringVar(&powerSecond, "second", "sequential", "second strategy to compare")
+	powerCmd.Flags().Float64Var(&powerDifference, "difference", 0, "minimal detectable difference between the strategies, in milliseconds")
+	powerCmd.Flags().Float64Var(&powerAlpha, "alpha", 0.05, "significance level")
+	powerCmd.Flags().Float64Var(&powerPower, "power", 0.8, "target power")
+	powerCmd.Flags().StringVar(&powerRun, "run", "", "use only the pilot results of the given run ID")
+	powerCmd.Flags().StringVar(&powerWriteEnv, "write-env", "", "env file in which REPETITIONS is set to the estimate")
+	powerCmd.MarkFlagRequired("difference")
+	rootCmd.AddCommand(powerCmd)
+}
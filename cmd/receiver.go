@@ -1,26 +1,71 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/leonardopoggiani/lmo-performance-evaluation/control"
 	pkg "github.com/leonardopoggiani/lmo-performance-evaluation/pkg"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/transfer"
 	"github.com/spf13/cobra"
 	"github.com/withmandala/go-log"
 )
 
+var (
+	receiverWaitTimeout        time.Duration
+	receiverRestoreConcurrency int
+	receiverRestoreStrategy    string
+	receiverTransferListen     string
+)
+
 // serveCmd represents the serve command
 var receiverCmd = &cobra.Command{
 	Use:   "receiver",
 	Short: "Start the receiver process",
 	Long: `Start the receiver process for the Live Migration Operator.
 The receiver will be started in the test namespace and will:
-- 
-- `,
+- listen for migration announcements on $CONTROL_LISTEN (default :8089) and queue them
+- accept archives uploaded over HTTP on the same address, and as tar over TCP on
+  --transfer-listen, for senders that do not use the operator to move them
+- restore up to --restore-concurrency migrations at once, each from its own subdirectory
+  of $CHECKPOINTS_FOLDER, removed afterwards unless the restore failed and
+  $KEEP_FAILED_CHECKPOINTS is set, reporting the time spent in the queue apart from the restore
+- restore with --restore-strategy, sequential or parallel, unless the sender chose one,
+  and store the strategy on every total_times row
+- wait for the announced archives to be complete, check their SHA-256 against the
+  manifest and restore the pod, or fail the trial with the class of the mismatch
+- report the restore phases and timings back to the sender, up to the first request
+  answered by the restored pod on $FIRST_REQUEST_PORT (default 80)
+It stops when no migration is announced within --wait-timeout, and on SIGINT or SIGTERM
+it removes the dummy pod and service and the restored pods before exiting.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		pkg.Receive(log.New(os.Stderr).WithColor())
+		logger := log.New(os.Stderr).WithColor()
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		err := pkg.Receive(ctx, logger, pkg.ReceiverOptions{
+			WaitTimeout:        receiverWaitTimeout,
+			RestoreConcurrency: receiverRestoreConcurrency,
+			RestoreStrategy:    receiverRestoreStrategy,
+			TransferListen:     receiverTransferListen,
+		})
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logger.Error(err)
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(receiverCmd)
+
+	receiverCmd.Flags().DurationVar(&receiverWaitTimeout, "wait-timeout", pkg.DefaultWaitTimeout, "how long to wait for a migration before giving up")
+	receiverCmd.Flags().IntVar(&receiverRestoreConcurrency, "restore-concurrency", pkg.DefaultRestoreConcurrency, "how many migrations to restore at once")
+	receiverCmd.Flags().StringVar(&receiverRestoreStrategy, "restore-strategy", control.RestoreSequential, "how to restore the pods, sequential or parallel")
+	receiverCmd.Flags().StringVar(&receiverTransferListen, "transfer-listen", transfer.DefaultListen, "address of the tar-over-TCP transfers, empty to disable them")
 }
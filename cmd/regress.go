@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/joho/godotenv"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/report"
+	"github.com/spf13/cobra"
+	"github.com/withmandala/go-log"
+)
+
+var (
+	regressBaseline  string
+	regressCandidate string
+	regressOptions   report.RegressionOptions
+)
+
+var regressCmd = &cobra.Command{
+	Use:   "regress",
+	Short: "Compare a candidate run against a baseline run",
+	Long: `Compare every cell (scenario, strategy, container count) of the candidate run against the
+baseline run. A cell regressed when its mean grew by more than the tolerance and the
+statistical test is significant. The command exits with status 1 on any regression,
+or when a cell of the baseline has fewer than two values in the candidate run or a zero
+mean unless --allow-missing is set, so it can be used to gate changes of the Live
+Migration Operator.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := log.New(os.Stderr).WithColor()
+		logger.Info("regress command called")
+
+		godotenv.Load(".env")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		db, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+		if err != nil {
+			logger.Errorf("Unable to connect to database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close(ctx)
+
+		baseline, err := report.Load(ctx, db, report.Filter{RunID: regressBaseline})
+		if err != nil {
+			logger.Errorf("Unable to load baseline: %v", err)
+			os.Exit(1)
+		}
+
+		candidate, err := report.Load(ctx, db, report.Filter{RunID: regressCandidate})
+		if err != nil {
+			logger.Errorf("Unable to load candidate: %v", err)
+			os.Exit(1)
+		}
+
+		comparisons, err := report.Compare(baseline, candidate, regressOptions)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		if err := report.WriteRegression(os.Stdout, comparisons); err != nil {
+			logger.Errorf("Unable to write the comparison: %v", err)
+			os.Exit(1)
+		}
+
+		if report.Regressed(comparisons) {
+			logger.Error("Significant regression detected")
+			os.Exit(1)
+		}
+
+		if report.Failed(comparisons, regressOptions) {
+			logger.Error("Cells of the baseline are missing from the candidate run or have a zero mean")
+			os.Exit(1)
+		}
+
+		logger.Info("No significant regression")
+	},
+}
+
+func init() {
+	regressCmd.Flags().StringVar(&regressBaseline, "baseline", "", "ID of the baseline run")
+	regressCmd.Flags().StringVar(&regressCandidate, "candidate", "", "ID of the candidate run")
+	regressCmd.Flags().Float64Var(&regressOptions.Tolerance, "tolerance", 0.05, "relative change of the mean tolerated before flagging a regression")
+	regressCmd.Flags().Float64Var(&regressOptions.Alpha, "alpha", 0.05, "significance level of the statistical test")
+	regressCmd.Flags().StringVar(&regressOptions.Test, "test", "welch", "statistical test: welch or mannwhitney")
+	regressCmd.Flags().BoolVar(&regressOptions.AllowMissing, "allow-missing", false, "do not fail when cells of the baseline are missing from the candidate run or have a zero mean")
+	regressCmd.MarkFlagRequired("baseline")
+	regressCmd.MarkFlagRequired("candidate")
+	rootCmd.AddCommand(regressCmd)
+}
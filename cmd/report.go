@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/joho/godotenv"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/report"
+	"github.com/spf13/cobra"
+	"github.com/withmandala/go-log"
+)
+
+var (
+	reportHTML   bool
+	reportFormat string
+	reportUnit   string
+	reportDigits int
+	reportOutput string
+	reportRun    string
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Summarise the results stored in the database",
+	Long: `Summarise the measurements stored in the database, per scenario, strategy and container count.
+With --html (or --format html) a single self-contained HTML file is written, including
+run metadata, environment fingerprint, summary tables, charts and the list of failed trials.
+With --format latex or --format markdown the mean ± 95% CI of every strategy and container
+count is printed as a table ready for papers, with the query and filters as a comment.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := log.New(os.Stderr).WithColor()
+		logger.Info("report command called")
+
+		godotenv.Load(".env")
+
+		// The options are checked before anything is read or written.
+		if reportHTML {
+			reportFormat = "html"
+		}
+
+		options, err := report.ParseTableOptions(reportUnit, reportDigits)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		writers := map[string]func(io.Writer, *report.Report) error{
+			"html": report.WriteHTML,
+			"latex": func(w io.Writer, result *report.Report) error {
+				return report.WriteLaTeX(w, result, options)
+			},
+			"markdown": func(w io.Writer, result *report.Report) error {
+				return report.WriteMarkdown(w, result, options)
+			},
+			"text": report.WriteText,
+		}
+
+		write, ok := writers[reportFormat]
+		if !ok {
+			logger.Errorf("Unknown format %s, expected one of text, html, latex, markdown", reportFormat)
+			os.Exit(1)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		db, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+		if err != nil {
+			logger.Errorf("Unable to connect to database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close(ctx)
+
+		result, err := report.Load(ctx, db, report.Filter{RunID: reportRun})
+		if err != nil {
+			logger.Errorf("Unable to load report: %v", err)
+			os.Exit(1)
+		}
+
+		output := os.Stdout
+		if reportOutput != "" {
+			output, err = os.Create(reportOutput)
+			if err != nil {
+				logger.Errorf("Unable to create %s: %v", reportOutput, err)
+				os.Exit(1)
+			}
+		}
+
+		err = write(output, result)
+		if reportOutput != "" {
+			if closeErr := output.Close(); err == nil {
+				err = closeErr
+			}
+		}
+
+		if err != nil {
+			logger.Errorf("Unable to write report: %v", err)
+			os.Exit(1)
+		}
+
+		if reportOutput != "" {
+			logger.Infof("Report written to %s", reportOutput)
+		}
+	},
+}
+
+func init() {
+	reportCmd.Flags().BoolVar(&reportHTML, "html", false, "write a self-contained HTML report, same as --format html")
+	reportCmd.Flags().StringVar(&reportFormat, "format", "text", "output format: text, html, latex or markdown")
+	reportCmd.Flags().StringVar(&reportUnit, "unit", "ms", "time unit of the latex and markdown tables: us, ms or s")
+	reportCmd.Flags().IntVar(&reportDigits, "digits", 3, "significant digits of the latex and markdown tables")
+	reportCmd.Flags().StringVarP(&reportOutput, "output", "o", "", "output file (default stdout)")
+	reportCmd.Flags().StringVar(&reportRun, "run", "", "restrict the report to the given run ID")
+	rootCmd.AddCommand(reportCmd)
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/leonardopoggiani/live-migration-operator/controllers"
+	pkg "github.com/leonardopoggiani/lmo-performance-evaluation/pkg"
 	"github.com/spf13/cobra"
 	"github.com/withmandala/go-log"
 	"k8s.io/client-go/kubernetes"
@@ -12,8 +13,11 @@ import (
 )
 
 var restoreCmd = &cobra.Command{
-	Use:   "restore",
+	Use:   "restore [trial]",
 	Short: "Restore the given pod",
+	Long: `Restore the pod from the checkpoint archives in $CHECKPOINTS_FOLDER, or in the
+directory of the given trial, e.g. one kept after a failure with $KEEP_FAILED_CHECKPOINTS.`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		logger := log.New(os.Stderr).WithColor()
 		logger.Info("restore command called")
@@ -49,10 +53,20 @@ var restoreCmd = &cobra.Command{
 		namespace := os.Getenv("NAMESPACE")
 
 		controller := controllers.LiveMigrationReconciler{}
-		controller.BuildahRestore(ctx, "/tmp/checkpoints/checkpoints", clientset, namespace)
+		controller.BuildahRestore(ctx, checkpointDirectory(args), clientset, namespace)
 	},
 }
 
+// checkpointDirectory returns the directory of the trial named in args, the
+// checkpoint root when there is none.
+func checkpointDirectory(args []string) string {
+	if len(args) == 0 {
+		return pkg.CheckpointRoot()
+	}
+
+	return pkg.OpenTrial(args[0]).Directory
+}
+
 func init() {
 	rootCmd.AddCommand(restoreCmd)
 }
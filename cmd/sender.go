@@ -12,10 +12,23 @@ import (
 var senderCmd = &cobra.Command{
 	Use:   "sender",
 	Short: "Start the sender process",
-	Long: `Start the receiver process for the Live Migration Operator.
-	The receiver will be started in the test namespace and will:
-	- 
-	- `,
+	Long: `Start the sender process for the Live Migration Operator.
+	The sender will checkpoint test pods in the test namespace and, for every one:
+	- compress the checkpoint archives with the codec set in $COMPRESSION, if any:
+	  gzip, lz (LZ4-like, fast with a modest ratio) or lzh (zstd-like, lz followed by Huffman
+	  coding) with an optional level from 1 to 9, e.g. lz:4, recording the ratio and the
+	  compression and decompression times
+	- migrate the checkpoint archives to the receiver with the transport set in $TRANSPORT:
+	  operator (default), local (copy to $TRANSPORT_PATH), http (upload to $RECEIVER_URL)
+	  or tcp (tar stream to $TRANSPORT_ADDRESS), recording bytes and throughput; the last
+	  three can cross a link emulated as set in $LINK, e.g. rate=100mbit,delay=20ms,jitter=5ms,
+	  stall=0.001, with profiles separated by ";" used by the trials in turn
+	- announce the migration on the control channel of the receiver at $RECEIVER_URL,
+	  with the restore strategy set in $RESTORE_STRATEGY (sequential or parallel) if any
+	- wait for the receiver to report the restore phases and timings
+	Every migration checkpoints into its own subdirectory of $CHECKPOINTS_FOLDER, removed
+	afterwards unless the migration failed and $KEEP_FAILED_CHECKPOINTS is set. The folder
+	must be the one the operator writes to, /tmp/checkpoints/checkpoints.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		pkg.Sender(log.New(os.Stderr).WithColor())
 	},
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/joho/godotenv"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/report"
+	"github.com/spf13/cobra"
+	"github.com/withmandala/go-log"
+)
+
+var (
+	trendBy        string
+	trendTables    []string
+	trendAlpha     float64
+	trendMinChange float64
+)
+
+var trendCmd = &cobra.Command{
+	Use:   "trend",
+	Short: "Show how the results evolved across runs or days",
+	Long: `Group the measurements by run (or by day) and show how the mean and p95 of every
+strategy and container count evolved. Step changes are detected with binary segmentation
+and the run (or day) that introduced them is highlighted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := log.New(os.Stderr).WithColor()
+		logger.Info("trend command called")
+
+		godotenv.Load(".env")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		db, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+		if err != nil {
+			logger.Errorf("Unable to connect to database: %v\n", err)
+			os.Exit(1)
+		}
+		defer db.Close(ctx)
+
+		for _, table := range trendTables {
+			trends, err := report.LoadTrends(ctx, db, table, trendBy)
+			if err != nil {
+				logger.Errorf("Skipping %s: %v", table, err)
+				continue
+			}
+
+			for i := range trends {
+				report.MarkChangePoints(&trends[i], trendAlpha, trendMinChange)
+			}
+
+			report.WriteTrends(os.Stdout, trends)
+		}
+	},
+}
+
+func init() {
+	trendCmd.Flags().StringVar(&trendBy, "by", "run", "group the measurements by run or day")
+	trendCmd.Flags().StringSliceVar(&trendTables, "table", report.Scenarios, "tables to analyse")
+	trendCmd.Flags().Float64Var(&trendAlpha, "alpha", 0.01, "significance level of the change-point test")
+	trendCmd.Flags().Float64Var(&trendMinChange, "min-change", 0.05, "minimum relative change of the mean to report a step")
+	rootCmd.AddCommand(trendCmd)
+}
@@ -0,0 +1,243 @@
+package consistency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/withmandala/go-log"
+)
+
+// Entry is a write held in the history of the stateful app.
+type Entry struct {
+	Seq     int64     `json:"seq"`
+	Value   string    `json:"value"`
+	Written time.Time `json:"written"`
+}
+
+// State is the state the stateful app reports on /state.
+type State struct {
+	BootID   string    `json:"boot_id"`
+	PID      int       `json:"pid"`
+	Started  time.Time `json:"started"`
+	Counter  int64     `json:"counter"`
+	Entries  int       `json:"entries"`
+	Checksum string    `json:"checksum"`
+}
+
+// Snapshot is taken before the migration: the state of the app once every
+// write was acknowledged, and the writes themselves.
+type Snapshot struct {
+	Target string    `json:"target"`
+	Taken  time.Time `json:"taken"`
+	State  State     `json:"state"`
+	Writes []Entry   `json:"writes"`
+}
+
+// Check is the outcome of verifying the app after the restore.
+// SameProcess is set when the boot ID and the start time did not change, i.e.
+// the process was restored rather than started again. ChecksumMatch is set
+// when the history chains to the checksum of the snapshot up to its last write
+// and to the checksum reported after the restore as a whole, so that a
+// reordered or altered history is caught even when every write is present.
+type Check struct {
+	Target        string
+	SameProcess   bool
+	Writes        int
+	LostWrites    int
+	ChecksumMatch bool
+	CounterBefore int64
+	CounterAfter  int64
+	Before        State
+	After         State
+}
+
+// Intact reports whether the restored process kept every write, in order.
+func (c Check) Intact() bool {
+	return c.SameProcess && c.LostWrites == 0 && c.ChecksumMatch && c.CounterAfter >= c.CounterBefore
+}
+
+// ChainChecksum chains the values of entries the way the stateful app does:
+// every write hashes the previous checksum followed by its value.
+func ChainChecksum(entries []Entry) string {
+	var checksum [sha256.Size]byte
+	for _, entry := range entries {
+		checksum = sha256.Sum256(append(checksum[:], entry.Value...))
+	}
+
+	return hex.EncodeToString(checksum[:])
+}
+
+// Client talks to the stateful app.
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewClient(address string, timeout time.Duration) *Client {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	return &Client{baseURL: strings.TrimSuffix(address, "/"), client: &http.Client{Timeout: timeout}}
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, into any) error {
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: unexpected status code %d", method, path, response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(into)
+}
+
+func (c *Client) State(ctx context.Context) (State, error) {
+	var state State
+	err := c.do(ctx, http.MethodGet, "/state", &state)
+	return state, err
+}
+
+func (c *Client) History(ctx context.Context) ([]Entry, error) {
+	var history []Entry
+	err := c.do(ctx, http.MethodGet, "/history", &history)
+	return history, err
+}
+
+func (c *Client) Write(ctx context.Context, value string) (Entry, error) {
+	var entry Entry
+	err := c.do(ctx, http.MethodPost, "/write?value="+url.QueryEscape(value), &entry)
+	return entry, err
+}
+
+// Prepare writes count values to the app and takes a snapshot of its state.
+func Prepare(ctx context.Context, client *Client, target string, count int) (*Snapshot, error) {
+	snapshot := &Snapshot{Target: target}
+
+	for i := 0; i < count; i++ {
+		entry, err := client.Write(ctx, fmt.Sprintf("%s-%d-%d", target, time.Now().UnixNano(), i))
+		if err != nil {
+			return nil, fmt.Errorf("write %d: %w", i, err)
+		}
+
+		snapshot.Writes = append(snapshot.Writes, entry)
+	}
+
+	state, err := client.State(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot.State = state
+	snapshot.Taken = time.Now()
+
+	return snapshot, nil
+}
+
+// Verify compares the state of the app after the restore with snapshot. A
+// write is lost when its sequence number is missing from the history or holds
+// a different value.
+func Verify(ctx context.Context, client *Client, snapshot *Snapshot) (Check, error) {
+	check := Check{
+		Target:        snapshot.Target,
+		Writes:        len(snapshot.Writes),
+		CounterBefore: snapshot.State.Counter,
+		Before:        snapshot.State,
+	}
+
+	state, err := client.State(ctx)
+	if err != nil {
+		return check, err
+	}
+
+	history, err := client.History(ctx)
+	if err != nil {
+		return check, err
+	}
+
+	check.After = state
+	check.CounterAfter = state.Counter
+	check.SameProcess = state.BootID == snapshot.State.BootID && state.Started.Equal(snapshot.State.Started)
+
+	values := make(map[int64]string, len(history))
+	for _, entry := range history {
+		values[entry.Seq] = entry.Value
+	}
+
+	for _, write := range snapshot.Writes {
+		if value, ok := values[write.Seq]; !ok || value != write.Value {
+			check.LostWrites++
+		}
+	}
+
+	// The history is served in write order, the checksums depend on it.
+	before := 0
+	for before < len(history) && history[before].Seq <= snapshot.State.Counter {
+		before++
+	}
+	check.ChecksumMatch = before == snapshot.State.Entries &&
+		ChainChecksum(history[:before]) == snapshot.State.Checksum &&
+		ChainChecksum(history) == state.Checksum
+
+	return check, nil
+}
+
+func SaveSnapshot(path string, snapshot *Snapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return snapshot, nil
+}
+
+// SaveCheckToDB records the outcome of a verification in the
+// consistency_checks table.
+func SaveCheckToDB(ctx context.Context, conn *pgx.Conn, numContainers int, check Check, failure error) {
+	logger := log.New(os.Stderr).WithColor()
+
+	errorMessage := ""
+	if failure != nil {
+		errorMessage = failure.Error()
+	}
+
+	_, err := conn.Exec(ctx, `INSERT INTO consistency_checks
+		(target, containers, same_process, boot_id_before, boot_id_after, writes, lost_writes, checksum_match, counter_before, counter_after, intact, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		check.Target, numContainers, check.SameProcess, check.Before.BootID, check.After.BootID,
+		check.Writes, check.LostWrites, check.ChecksumMatch, check.CounterBefore, check.CounterAfter, failure == nil && check.Intact(), errorMessage)
+	if err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,107 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client is the sender side of the control channel.
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewClient talks to the receiver at address, e.g. the value of RECEIVER_URL.
+func NewClient(address string) *Client {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	return &Client{baseURL: strings.TrimSuffix(address, "/"), client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Announce sends the announcement and returns the acknowledgement of the
+// receiver. A refused announcement is returned as an error.
+func (c *Client) Announce(ctx context.Context, announcement Announcement) (Ack, error) {
+	announcement.Sent = time.Now()
+
+	body, err := json.Marshal(announcement)
+	if err != nil {
+		return Ack{}, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/migrations", bytes.NewReader(body))
+	if err != nil {
+		return Ack{}, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return Ack{}, err
+	}
+	defer response.Body.Close()
+
+	ack := Ack{}
+	if err := json.NewDecoder(response.Body).Decode(&ack); err != nil {
+		return ack, fmt.Errorf("announce: unexpected status code %d: %w", response.StatusCode, err)
+	}
+
+	if !ack.Accepted {
+		return ack, fmt.Errorf("migration %s refused: %s", announcement.MigrationID, ack.Error)
+	}
+
+	return ack, nil
+}
+
+// Status returns the progress of a migration.
+func (c *Client) Status(ctx context.Context, id string) (Status, error) {
+	status := Status{}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/migrations/"+url.PathEscape(id), nil)
+	if err != nil {
+		return status, err
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return status, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return status, fmt.Errorf("status of %s: unexpected status code %d", id, response.StatusCode)
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&status)
+	return status, err
+}
+
+// Wait polls the status of a migration until the receiver finished it or the
+// context is done. Transient errors are retried until then.
+func (c *Client) Wait(ctx context.Context, id string, poll time.Duration) (Status, error) {
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for {
+		status, err := c.Status(ctx, id)
+		if err == nil && status.Finished() {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err == nil {
+				err = ctx.Err()
+			}
+			return status, fmt.Errorf("waiting for migration %s: %w", id, err)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultClockProbes is how many timestamp exchanges an offset estimate is
+// based on.
+const DefaultClockProbes = 8
+
+// ClockReply is the answer of the receiver to a clock probe: when the request
+// arrived and when the reply left, both read from the receiver clock.
+type ClockReply struct {
+	Received time.Time `json:"received"`
+	Replied  time.Time `json:"replied"`
+}
+
+// ClockSample holds the four timestamps of an NTP-style exchange. Sent and
+// Returned are read from the sender clock, Received and Replied from the
+// receiver clock.
+type ClockSample struct {
+	Sent     time.Time
+	Received time.Time
+	Replied  time.Time
+	Returned time.Time
+}
+
+// Offset is how far the receiver clock is ahead of the sender clock, assuming
+// the request and the reply took as long.
+func (s ClockSample) Offset() time.Duration {
+	return (s.Received.Sub(s.Sent) + s.Replied.Sub(s.Returned)) / 2
+}
+
+// RoundTrip is the time spent on the network, without the time the receiver
+// took to reply.
+func (s ClockSample) RoundTrip() time.Duration {
+	return s.Returned.Sub(s.Sent) - s.Replied.Sub(s.Received)
+}
+
+// ClockOffset is the estimated offset of the receiver clock with respect to
+// the sender clock. The true offset lies within Offset ± Uncertainty.
+type ClockOffset struct {
+	Measured    time.Time
+	Offset      time.Duration
+	Uncertainty time.Duration
+	RoundTrip   time.Duration
+	Samples     int
+}
+
+// ToSender converts a time read from the receiver clock to the sender clock.
+func (o ClockOffset) ToSender(t time.Time) time.Time {
+	return t.Add(-o.Offset)
+}
+
+// EstimateOffset keeps the sample with the shortest round trip, as NTP does,
+// since it is the least affected by asymmetric delays. The error of its offset
+// is bounded by half of its round trip.
+func EstimateOffset(samples []ClockSample) (ClockOffset, error) {
+	if len(samples) == 0 {
+		return ClockOffset{}, errors.New("no clock samples")
+	}
+
+	best := samples[0]
+	for _, sample := range samples[1:] {
+		if sample.RoundTrip() < best.RoundTrip() {
+			best = sample
+		}
+	}
+
+	return ClockOffset{
+		Measured:    best.Sent,
+		Offset:      best.Offset(),
+		Uncertainty: best.RoundTrip() / 2,
+		RoundTrip:   best.RoundTrip(),
+		Samples:     len(samples),
+	}, nil
+}
+
+func (s *Server) clock(w http.ResponseWriter, r *http.Request) {
+	received := time.Now()
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ClockReply{Received: received, Replied: time.Now()})
+}
+
+// probeClock runs a single timestamp exchange with the receiver.
+func (c *Client) probeClock(ctx context.Context) (ClockSample, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/clock", nil)
+	if err != nil {
+		return ClockSample{}, err
+	}
+
+	sample := ClockSample{Sent: time.Now()}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return sample, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return sample, fmt.Errorf("clock: unexpected status code %d", response.StatusCode)
+	}
+
+	reply := ClockReply{}
+	err = json.NewDecoder(response.Body).Decode(&reply)
+	sample.Returned = time.Now()
+	if err != nil {
+		return sample, err
+	}
+
+	sample.Received, sample.Replied = reply.Received, reply.Replied
+	return sample, nil
+}
+
+// MeasureClockOffset runs probes timestamp exchanges with the receiver and
+// estimates the offset of its clock. Failed probes are skipped as long as one
+// succeeds.
+func (c *Client) MeasureClockOffset(ctx context.Context, probes int) (ClockOffset, error) {
+	var samples []ClockSample
+	var lastErr error
+
+	for i := 0; i < probes; i++ {
+		sample, err := c.probeClock(ctx)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		samples = append(samples, sample)
+	}
+
+	if len(samples) == 0 {
+		return ClockOffset{}, fmt.Errorf("clock offset: every probe failed: %w", lastErr)
+	}
+
+	return EstimateOffset(samples)
+}
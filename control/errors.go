@@ -0,0 +1,58 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Classes of the integrity errors found while verifying a checkpoint
+// directory.
+const (
+	ErrorMissingFile      = "missing_file"
+	ErrorSizeMismatch     = "size_mismatch"
+	ErrorChecksumMismatch = "checksum_mismatch"
+	ErrorManifest         = "manifest"
+)
+
+// IntegrityError reports a file of the checkpoint directory that is missing
+// or does not match the manifest.
+type IntegrityError struct {
+	Class string
+	Path  string
+	Err   error
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Class, e.Path, e.Err)
+}
+
+func (e *IntegrityError) Unwrap() error {
+	return e.Err
+}
+
+// MigrationError is the failure of a migration as reported by the receiver.
+type MigrationError struct {
+	MigrationID string
+	Class       string
+	Message     string
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("migration %s failed: %s", e.MigrationID, e.Message)
+}
+
+// ErrorClass returns the class of err when it is an integrity error, either
+// local or reported by the receiver, and an empty string otherwise.
+func ErrorClass(err error) string {
+	var integrity *IntegrityError
+	if errors.As(err, &integrity) {
+		return integrity.Class
+	}
+
+	var migration *MigrationError
+	if errors.As(err, &migration) {
+		return migration.Class
+	}
+
+	return ""
+}
@@ -0,0 +1,207 @@
+package control
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ManifestEntry describes a file of the checkpoint directory, by its path
+// relative to the directory.
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type Manifest []ManifestEntry
+
+// ManifestFile is written by the sender next to the archives and names the
+// migration they belong to.
+const ManifestFile = "migration.json"
+
+// MigrationManifest is the content of ManifestFile.
+type MigrationManifest struct {
+	MigrationID string   `json:"migration_id"`
+	Files       Manifest `json:"files"`
+}
+
+// BuildManifest lists every regular file below directory, except ManifestFile,
+// with its size and SHA-256.
+func BuildManifest(directory string) (Manifest, error) {
+	var manifest Manifest
+
+	err := filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+
+		if relative == ManifestFile {
+			return nil
+		}
+
+		checksum, err := fileChecksum(path)
+		if err != nil {
+			return err
+		}
+
+		manifest = append(manifest, ManifestEntry{Path: relative, Size: info.Size(), SHA256: checksum})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(manifest, func(i, j int) bool { return manifest[i].Path < manifest[j].Path })
+
+	return manifest, nil
+}
+
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Verify checks that every file of the manifest is in directory with the
+// expected size. It is cheap enough to be polled while the files arrive.
+func (m Manifest) Verify(directory string) error {
+	for _, entry := range m {
+		info, err := os.Stat(filepath.Join(directory, entry.Path))
+		if errors.Is(err, fs.ErrNotExist) {
+			return &IntegrityError{Class: ErrorMissingFile, Path: entry.Path, Err: err}
+		}
+		if err != nil {
+			return err
+		}
+
+		if info.Size() != entry.Size {
+			return &IntegrityError{Class: ErrorSizeMismatch, Path: entry.Path,
+				Err: fmt.Errorf("%d bytes, expected %d", info.Size(), entry.Size)}
+		}
+	}
+
+	return nil
+}
+
+// VerifyChecksums checks the SHA-256 of every file of the manifest. Entries
+// without a checksum are only checked for size.
+func (m Manifest) VerifyChecksums(directory string) error {
+	if err := m.Verify(directory); err != nil {
+		return err
+	}
+
+	for _, entry := range m {
+		if entry.SHA256 == "" {
+			continue
+		}
+
+		checksum, err := fileChecksum(filepath.Join(directory, entry.Path))
+		if err != nil {
+			return err
+		}
+
+		if checksum != entry.SHA256 {
+			return &IntegrityError{Class: ErrorChecksumMismatch, Path: entry.Path,
+				Err: fmt.Errorf("sha256 %s, expected %s", checksum, entry.SHA256)}
+		}
+	}
+
+	return nil
+}
+
+// WriteManifestFile writes the manifest of migration id into directory, so
+// that it travels with the archives.
+func WriteManifestFile(directory string, id string, manifest Manifest) error {
+	data, err := json.MarshalIndent(MigrationManifest{MigrationID: id, Files: manifest}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(directory, ManifestFile), data, 0644)
+}
+
+// ReadManifestFile reads the manifest written by the sender into directory.
+func ReadManifestFile(directory string) (MigrationManifest, error) {
+	manifest := MigrationManifest{}
+
+	data, err := os.ReadFile(filepath.Join(directory, ManifestFile))
+	if err != nil {
+		return manifest, err
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("%s: %w", ManifestFile, err)
+	}
+
+	return manifest, nil
+}
+
+// WaitFor polls directory until its file sizes match the manifest and its
+// manifest file names migration id, so that the restore never starts from
+// partially written archives or from the archives of another migration. It
+// returns the last mismatch when the context is done first. Checksums are
+// left to VerifyChecksums, once the files are complete.
+func (m Manifest) WaitFor(ctx context.Context, directory string, id string, poll time.Duration) error {
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	check := func() error {
+		written, err := ReadManifestFile(directory)
+		if err != nil {
+			return &IntegrityError{Class: ErrorManifest, Path: ManifestFile, Err: err}
+		}
+
+		if written.MigrationID != id {
+			return &IntegrityError{Class: ErrorManifest, Path: ManifestFile,
+				Err: fmt.Errorf("archives of migration %s, expected %s", written.MigrationID, id)}
+		}
+
+		return m.Verify(directory)
+	}
+
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("checkpoint directory incomplete: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Package control implements the HTTP/JSON channel between the sender and the
+// receiver. The sender announces a migration once its archives are
+// transferred, the receiver acknowledges it, restores the pod and reports the
+// progress of every phase along with its own timings. Before each migration
+// the sender also estimates the offset of the receiver clock, so that times
+// read on the two hosts can be compared.
+package control
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// States of a migration on the receiver.
+const (
+	StateAnnounced = "announced"
+	StateRestoring = "restoring"
+	StateDone      = "done"
+	StateFailed    = "failed"
+)
+
+// Restore strategies of the receiver: BuildahRestore builds the image of one
+// container at a time, BuildahRestoreParallelized all at once.
+const (
+	RestoreSequential = "sequential"
+	RestoreParallel   = "parallel"
+)
+
+// ValidRestoreStrategy reports whether strategy is a known restore strategy.
+func ValidRestoreStrategy(strategy string) bool {
+	return strategy == RestoreSequential || strategy == RestoreParallel
+}
+
+// ValidDirectory reports whether name is a single directory right under the
+// checkpoint folder. The checkpoint folder itself, ".", is refused: the
+// directory of a migration is removed once it is done.
+func ValidDirectory(name string) bool {
+	return filepath.IsLocal(name) && filepath.Clean(name) != "." && !strings.ContainsAny(name, `/\`)
+}
+
+// DefaultListen is the address the receiver listens on when CONTROL_LISTEN is
+// not set.
+const DefaultListen = ":8089"
+
+type Container struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Announcement is sent by the sender once the checkpoint archives of a
+// migration have been transferred. Directory holds the archives of this
+// migration only and is relative to the checkpoint folder of the receiver, so
+// that several migrations can be in flight at once. RestoreStrategy overrides
+// the strategy of the receiver when set. When the archives were compressed
+// before the transfer, Compression names the codec and its level and
+// Compressed lists the files that actually travel; Manifest always describes
+// the archives once decompressed.
+type Announcement struct {
+	MigrationID        string      `json:"migration_id"`
+	Directory          string      `json:"directory"`
+	RestoreStrategy    string      `json:"restore_strategy,omitempty"`
+	Compression        string      `json:"compression,omitempty"`
+	Compressed         Manifest    `json:"compressed"`
+	Pod                string      `json:"pod"`
+	Namespace          string      `json:"namespace"`
+	CheckpointType     string      `json:"checkpoint_type"`
+	Containers         []Container `json:"containers"`
+	Manifest           Manifest    `json:"manifest"`
+	CheckpointStarted  time.Time   `json:"checkpoint_started"`
+	CheckpointFinished time.Time   `json:"checkpoint_finished"`
+	TransferFinished   time.Time   `json:"transfer_finished"`
+	Sent               time.Time   `json:"sent"`
+}
+
+// Ack is the immediate answer of the receiver to an announcement, with the
+// restore strategy it is going to use.
+type Ack struct {
+	MigrationID     string    `json:"migration_id"`
+	Accepted        bool      `json:"accepted"`
+	RestoreStrategy string    `json:"restore_strategy,omitempty"`
+	Received        time.Time `json:"received"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// Phases of a migration, in the order they run. The sender measures the ones
+// up to the transfer, the receiver the others. Queue is the time the
+// announcement waited for a free restore slot on the receiver. Compress and
+// Decompress only run when the archives are compressed for the transfer.
+const (
+	PhasePodCreation        = "pod_creation"
+	PhaseContainerDiscovery = "container_discovery"
+	PhaseCheckpoint         = "checkpoint"
+	PhaseArchiveHandOff     = "archive_handoff"
+	PhaseCompress           = "compress"
+	PhaseTransfer           = "transfer"
+	PhaseQueue              = "queue"
+	PhaseVerify             = "verify"
+	PhaseDecompress         = "decompress"
+	PhaseChecksum           = "checksum"
+	PhaseImageBuild         = "image_build"
+	PhasePodCreate          = "pod_create"
+	PhaseContainerReady     = "container_ready"
+	PhaseFirstRequest       = "first_request"
+)
+
+var Phases = []string{
+	PhasePodCreation, PhaseContainerDiscovery, PhaseCheckpoint, PhaseArchiveHandOff, PhaseCompress, PhaseTransfer,
+	PhaseQueue, PhaseVerify, PhaseDecompress, PhaseChecksum, PhaseImageBuild, PhasePodCreate, PhaseContainerReady,
+	PhaseFirstRequest,
+}
+
+// Phase is a timestamped step of a migration. End is zero while the phase is
+// running.
+type Phase struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Error string    `json:"error,omitempty"`
+}
+
+func (p Phase) Duration() time.Duration {
+	if p.End.IsZero() {
+		return 0
+	}
+
+	return p.End.Sub(p.Start)
+}
+
+// Timings are measured by the receiver with its own clock. QueueDelay is the
+// time between the announcement and the start of its restore, Decompression
+// the time spent decompressing the archives, Verification the time spent
+// checking their checksums. None is part of RestoreElapsed.
+type Timings struct {
+	Received       time.Time     `json:"received"`
+	QueueDelay     time.Duration `json:"queue_delay"`
+	Decompression  time.Duration `json:"decompression,omitempty"`
+	Verification   time.Duration `json:"verification"`
+	RestoreStart   time.Time     `json:"restore_start"`
+	RestoreEnd     time.Time     `json:"restore_end"`
+	RestoreElapsed time.Duration `json:"restore_elapsed"`
+}
+
+// Status is the progress of a migration as reported by the receiver.
+type Status struct {
+	MigrationID     string  `json:"migration_id"`
+	State           string  `json:"state"`
+	RestoreStrategy string  `json:"restore_strategy"`
+	Phases          []Phase `json:"phases"`
+	Timings         Timings `json:"timings"`
+	Error           string  `json:"error,omitempty"`
+	ErrorClass      string  `json:"error_class,omitempty"`
+}
+
+// Finished reports whether the receiver is done with the migration, either way.
+func (s Status) Finished() bool {
+	return s.State == StateDone || s.State == StateFailed
+}
+
+// Err returns the failure reported by the receiver, nil unless the migration
+// failed.
+func (s Status) Err() error {
+	if s.State != StateFailed {
+		return nil
+	}
+
+	return &MigrationError{MigrationID: s.MigrationID, Class: s.ErrorClass, Message: s.Error}
+}
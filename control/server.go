@@ -0,0 +1,276 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queueLength bounds the migrations announced but not yet picked up.
+const queueLength = 16
+
+// finishedTTL is how long the status of a finished migration is kept for the
+// sender to read it.
+const finishedTTL = 10 * time.Minute
+
+// Server is the receiver side of the control channel. Announced migrations are
+// queued and handed out by Next; the receiver then reports progress through
+// StartPhase, EndPhase and Finish, which the sender polls. The status of a
+// finished migration is dropped finishedTTL later.
+type Server struct {
+	mu              sync.Mutex
+	migrations      map[string]*Status
+	finished        map[string]time.Time
+	queue           chan Announcement
+	restoreStrategy string
+	handlers        map[string]http.Handler
+}
+
+// NewServer hands out the announced migrations with their restore strategy
+// set, restoreStrategy unless the sender chose one.
+func NewServer(restoreStrategy string) *Server {
+	return &Server{
+		migrations:      map[string]*Status{},
+		finished:        map[string]time.Time{},
+		queue:           make(chan Announcement, queueLength),
+		restoreStrategy: restoreStrategy,
+		handlers:        map[string]http.Handler{},
+	}
+}
+
+// Handle serves handler on pattern next to the control channel, e.g. the
+// uploads of the archives. It must be called before ListenAndServe.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.handlers[pattern] = handler
+}
+
+// Handler serves POST /migrations to announce a migration,
+// GET /migrations/{id} to read its status, GET /clock to estimate the clock
+// offset between the hosts and the patterns given to Handle.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/migrations", s.announce)
+	mux.HandleFunc("/migrations/", s.status)
+	mux.HandleFunc("/clock", s.clock)
+	for pattern, handler := range s.handlers {
+		mux.Handle(pattern, handler)
+	}
+
+	return mux
+}
+
+// ListenAndServe serves the control channel on address until the context is
+// canceled.
+func (s *Server) ListenAndServe(ctx context.Context, address string) error {
+	server := &http.Server{Addr: address, Handler: s.Handler()}
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func (s *Server) announce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ack := Ack{Received: time.Now()}
+
+	announcement := Announcement{}
+	if err := json.NewDecoder(r.Body).Decode(&announcement); err != nil {
+		ack.Error = err.Error()
+		writeJSON(w, http.StatusBadRequest, ack)
+		return
+	}
+
+	ack.MigrationID = announcement.MigrationID
+	if announcement.MigrationID == "" {
+		ack.Error = "missing migration ID"
+		writeJSON(w, http.StatusBadRequest, ack)
+		return
+	}
+
+	if !ValidDirectory(announcement.Directory) {
+		ack.Error = fmt.Sprintf("invalid migration directory %q", announcement.Directory)
+		writeJSON(w, http.StatusBadRequest, ack)
+		return
+	}
+
+	if announcement.RestoreStrategy == "" {
+		announcement.RestoreStrategy = s.restoreStrategy
+	}
+
+	if !ValidRestoreStrategy(announcement.RestoreStrategy) {
+		ack.Error = fmt.Sprintf("unknown restore strategy %q", announcement.RestoreStrategy)
+		writeJSON(w, http.StatusBadRequest, ack)
+		return
+	}
+	ack.RestoreStrategy = announcement.RestoreStrategy
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evict(time.Now())
+
+	if _, ok := s.migrations[announcement.MigrationID]; ok {
+		ack.Error = fmt.Sprintf("migration %s already announced", announcement.MigrationID)
+		writeJSON(w, http.StatusConflict, ack)
+		return
+	}
+
+	select {
+	case s.queue <- announcement:
+	default:
+		ack.Error = "too many pending migrations"
+		writeJSON(w, http.StatusServiceUnavailable, ack)
+		return
+	}
+
+	s.migrations[announcement.MigrationID] = &Status{
+		MigrationID:     announcement.MigrationID,
+		State:           StateAnnounced,
+		RestoreStrategy: announcement.RestoreStrategy,
+		Timings:         Timings{Received: ack.Received},
+	}
+
+	ack.Accepted = true
+	writeJSON(w, http.StatusAccepted, ack)
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/migrations/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.migrations[id]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown migration %s", id), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// Next waits for the next announced migration. The time it spent in the queue
+// is recorded as its first phase.
+func (s *Server) Next(ctx context.Context) (Announcement, error) {
+	select {
+	case <-ctx.Done():
+		return Announcement{}, ctx.Err()
+	case announcement := <-s.queue:
+		pickedUp := time.Now()
+		s.update(announcement.MigrationID, func(status *Status) {
+			status.Phases = append(status.Phases, Phase{Name: PhaseQueue, Start: status.Timings.Received, End: pickedUp})
+		})
+		return announcement, nil
+	}
+}
+
+// evict drops the migrations finished more than finishedTTL before now. The
+// caller holds the lock.
+func (s *Server) evict(now time.Time) {
+	for id, finished := range s.finished {
+		if now.Sub(finished) > finishedTTL {
+			delete(s.migrations, id)
+			delete(s.finished, id)
+		}
+	}
+}
+
+func (s *Server) update(id string, change func(status *Status)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status, ok := s.migrations[id]; ok {
+		change(status)
+	}
+}
+
+// StartPhase records the start of a restore phase.
+func (s *Server) StartPhase(id string, name string) {
+	s.update(id, func(status *Status) {
+		status.State = StateRestoring
+		status.Phases = append(status.Phases, Phase{Name: name, Start: time.Now()})
+	})
+}
+
+// EndPhase records the end of the last phase named name.
+func (s *Server) EndPhase(id string, name string, err error) {
+	s.update(id, func(status *Status) {
+		for i := len(status.Phases) - 1; i >= 0; i-- {
+			if status.Phases[i].Name == name && status.Phases[i].End.IsZero() {
+				status.Phases[i].End = time.Now()
+				if err != nil {
+					status.Phases[i].Error = err.Error()
+				}
+				return
+			}
+		}
+	})
+}
+
+// RecordPhase adds a phase measured separately, e.g. when its bounds are only
+// known after the fact.
+func (s *Server) RecordPhase(id string, phase Phase) {
+	s.update(id, func(status *Status) {
+		status.State = StateRestoring
+		status.Phases = append(status.Phases, phase)
+	})
+}
+
+// Phases returns a copy of the phases recorded so far for a migration.
+func (s *Server) Phases(id string) []Phase {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.migrations[id]
+	if !ok {
+		return nil
+	}
+
+	return append([]Phase(nil), status.Phases...)
+}
+
+// Finish completes the migration with the timings measured by the receiver,
+// or marks it failed when err is set.
+func (s *Server) Finish(id string, timings Timings, err error) {
+	s.update(id, func(status *Status) {
+		timings.Received = status.Timings.Received
+		status.Timings = timings
+		status.State = StateDone
+		if err != nil {
+			status.State = StateFailed
+			status.Error = err.Error()
+			status.ErrorClass = ErrorClass(err)
+		}
+		s.finished[id] = time.Now()
+	})
+}
@@ -0,0 +1,56 @@
+package latency
+
+import (
+	"context"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/withmandala/go-log"
+)
+
+// SaveAttemptsToDB records a batch of probe attempts, successful or not, in the
+// latency_probes table with a single copy, and the successful ones in the
+// latency table as well, as the "service" latencies they always were, with
+// their target apart.
+func SaveAttemptsToDB(ctx context.Context, conn *pgx.Conn, numContainers int, attempts []Attempt) {
+	logger := log.New(os.Stderr).WithColor()
+
+	probes := make([][]any, 0, len(attempts))
+	var latencies [][]any
+
+	for _, attempt := range attempts {
+		errorMessage := ""
+		if attempt.Err != nil {
+			errorMessage = attempt.Err.Error()
+		}
+
+		scheduled := attempt.Scheduled
+		if scheduled.IsZero() {
+			scheduled = attempt.Start
+		}
+
+		probes = append(probes, []any{attempt.Start, scheduled, attempt.Target, numContainers, attempt.StatusCode,
+			attempt.ErrorClass, errorMessage, int64(attempt.DNS), int64(attempt.Connect), int64(attempt.TTFB), int64(attempt.Total)})
+
+		if attempt.Success() {
+			latencies = append(latencies, []any{numContainers, int64(attempt.Total), "service", attempt.Target})
+		}
+	}
+
+	_, err := conn.CopyFrom(ctx, pgx.Identifier{"latency_probes"},
+		[]string{"timestamp", "scheduled", "target", "containers", "status", "error_class", "error", "dns", "connect", "ttfb", "total"},
+		pgx.CopyFromRows(probes))
+	if err != nil {
+		logger.Error(err)
+	}
+
+	if len(latencies) == 0 {
+		return
+	}
+
+	_, err = conn.CopyFrom(ctx, pgx.Identifier{"latency"}, []string{"containers", "elapsed", "checkpoint_type", "target"},
+		pgx.CopyFromRows(latencies))
+	if err != nil {
+		logger.Error(err)
+	}
+}
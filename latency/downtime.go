@@ -0,0 +1,478 @@
+package latency
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/control"
+)
+
+// ProbeSample is a probe attempt as stored in latency_probes, placed at the
+// time it was scheduled.
+type ProbeSample struct {
+	Timestamp time.Time
+	Target    string
+	Success   bool
+	Total     time.Duration
+}
+
+// MigrationWindow is the interval between the start of a migration, recorded by
+// the sender in start_times, and the end of the restore, recorded by the
+// receiver in back_and_forth_times. End is zero when no restore was recorded.
+// Both are read from the sender clock: when the receiver clock offset was
+// measured, End was corrected by ClockOffset and is only accurate to within
+// Uncertainty. MigrationID is empty for rows written before migrations had
+// an ID.
+type MigrationWindow struct {
+	MigrationID string
+	Start       time.Time
+	End         time.Time
+	Containers  int
+	Corrected   bool
+	ClockOffset time.Duration
+	Uncertainty time.Duration
+}
+
+// Duration is the end-to-end time of the migration, zero without a restore.
+func (w MigrationWindow) Duration() time.Duration {
+	if w.End.IsZero() {
+		return 0
+	}
+
+	return w.End.Sub(w.Start)
+}
+
+// Downtime describes the service interruption observed during a migration.
+type Downtime struct {
+	Window             MigrationWindow
+	Interrupted        bool
+	DowntimeStart      time.Time
+	DowntimeEnd        time.Time
+	Downtime           time.Duration
+	FailedRequests     int
+	TimeToFirstSuccess time.Duration
+	LatencyBefore      time.Duration
+	LatencyAfter       time.Duration
+	Inflation          float64
+}
+
+// LoadProbes reads the probe attempts scheduled between since and until.
+func LoadProbes(ctx context.Context, conn *pgx.Conn, since time.Time, until time.Time) ([]ProbeSample, error) {
+	rows, err := conn.Query(ctx, `SELECT COALESCE(scheduled, timestamp), target, error_class, total FROM latency_probes
+		WHERE COALESCE(scheduled, timestamp) BETWEEN $1 AND $2 ORDER BY 1`, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []ProbeSample
+	for rows.Next() {
+		var sample ProbeSample
+		var errorClass *string
+		var total *float64
+
+		if err := rows.Scan(&sample.Timestamp, &sample.Target, &errorClass, &total); err != nil {
+			return nil, err
+		}
+
+		sample.Success = errorClass == nil || *errorClass == ErrorNone
+		if total != nil {
+			sample.Total = time.Duration(*total)
+		}
+
+		samples = append(samples, sample)
+	}
+
+	return samples, rows.Err()
+}
+
+// LoadMigrationWindows returns the migrations started between since and
+// until, in start order. Starts and restore ends are joined on their migration
+// ID; rows without one are paired by time instead, see pairWindows.
+func LoadMigrationWindows(ctx context.Context, conn *pgx.Conn, since time.Time, until time.Time) ([]MigrationWindow, error) {
+	windows, err := loadJoinedWindows(ctx, conn, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	unpaired, err := pairWindows(ctx, conn, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	windows = append(windows, unpaired...)
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Start.Before(windows[j].Start) })
+
+	return windows, nil
+}
+
+// loadJoinedWindows joins the starts recorded by the sender with the restore
+// ends and clock offsets of the same migration. Restore ends are moved to the
+// sender clock when the offset was measured.
+func loadJoinedWindows(ctx context.Context, conn *pgx.Conn, since time.Time, until time.Time) ([]MigrationWindow, error) {
+	rows, err := conn.Query(ctx, `SELECT s.migration_id, s.elapsed, COALESCE(s.containers, 0), e.elapsed, o.clock_offset, o.uncertainty
+		FROM start_times s
+		LEFT JOIN back_and_forth_times e ON e.migration_id = s.migration_id
+		LEFT JOIN clock_offsets o ON o.migration_id = s.migration_id
+		WHERE s.migration_id IS NOT NULL AND s.elapsed BETWEEN $1 AND $2
+		ORDER BY s.elapsed`, since.UnixMilli(), until.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var windows []MigrationWindow
+	for rows.Next() {
+		window := MigrationWindow{}
+		var start float64
+		var end, offset, uncertainty *float64
+
+		if err := rows.Scan(&window.MigrationID, &start, &window.Containers, &end, &offset, &uncertainty); err != nil {
+			return nil, err
+		}
+
+		window.Start = time.UnixMilli(int64(start))
+		if end != nil {
+			window.End = time.UnixMilli(int64(*end))
+		}
+
+		if end != nil && offset != nil && uncertainty != nil {
+			window.Corrected = true
+			window.ClockOffset = time.Duration(*offset)
+			window.Uncertainty = time.Duration(*uncertainty)
+			window.End = window.End.Add(-window.ClockOffset)
+		}
+
+		windows = append(windows, window)
+	}
+
+	return windows, rows.Err()
+}
+
+// pairWindows pairs every start without a migration ID with the first restore
+// end without one that follows it and precedes the next start. Restore ends
+// are first moved to the sender clock with the offset measured last before
+// them, if any.
+func pairWindows(ctx context.Context, conn *pgx.Conn, since time.Time, until time.Time) ([]MigrationWindow, error) {
+	starts, err := loadAbsoluteTimes(ctx, conn, "start_times", since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	ends, err := loadAbsoluteTimes(ctx, conn, "back_and_forth_times", since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(starts) == 0 {
+		return nil, nil
+	}
+
+	offsets, err := LoadClockOffsets(ctx, conn, since.Add(-clockOffsetLookback), until)
+	if err != nil {
+		return nil, err
+	}
+
+	corrected := make([]MigrationWindow, len(ends))
+	for i, end := range ends {
+		corrected[i] = MigrationWindow{End: end.Time}
+		if offset, ok := offsetBefore(offsets, end.Time); ok {
+			corrected[i] = MigrationWindow{
+				End:         offset.ToSender(end.Time),
+				Corrected:   true,
+				ClockOffset: offset.Offset,
+				Uncertainty: offset.Uncertainty,
+			}
+		}
+	}
+
+	windows := make([]MigrationWindow, 0, len(starts))
+	for i, start := range starts {
+		window := MigrationWindow{Start: start.Time, Containers: start.Containers}
+
+		for _, end := range corrected {
+			if end.End.After(start.Time) && (i == len(starts)-1 || end.End.Before(starts[i+1].Time)) {
+				window.End = end.End
+				window.Corrected, window.ClockOffset, window.Uncertainty = end.Corrected, end.ClockOffset, end.Uncertainty
+				break
+			}
+		}
+
+		windows = append(windows, window)
+	}
+
+	return windows, nil
+}
+
+// clockOffsetLookback is how far before the analysed window an offset
+// measurement is still used.
+const clockOffsetLookback = time.Hour
+
+// LoadClockOffsets reads the receiver clock offsets measured by the sender
+// between since and until, in time order.
+func LoadClockOffsets(ctx context.Context, conn *pgx.Conn, since time.Time, until time.Time) ([]control.ClockOffset, error) {
+	rows, err := conn.Query(ctx, `SELECT timestamp, clock_offset, uncertainty, round_trip, samples FROM clock_offsets
+		WHERE timestamp BETWEEN $1 AND $2 ORDER BY timestamp`, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var offsets []control.ClockOffset
+	for rows.Next() {
+		var offset control.ClockOffset
+		var value, uncertainty, roundTrip float64
+
+		if err := rows.Scan(&offset.Measured, &value, &uncertainty, &roundTrip, &offset.Samples); err != nil {
+			return nil, err
+		}
+
+		offset.Offset = time.Duration(value)
+		offset.Uncertainty = time.Duration(uncertainty)
+		offset.RoundTrip = time.Duration(roundTrip)
+		offsets = append(offsets, offset)
+	}
+
+	return offsets, rows.Err()
+}
+
+// offsetBefore returns the last offset measured before t, which is read from
+// the receiver clock. Offsets are measured at the start of each migration, so
+// this is the one of the migration t belongs to.
+func offsetBefore(offsets []control.ClockOffset, t time.Time) (control.ClockOffset, bool) {
+	found := false
+	var last control.ClockOffset
+
+	for _, offset := range offsets {
+		if offset.Measured.After(offset.ToSender(t)) {
+			break
+		}
+
+		last, found = offset, true
+	}
+
+	return last, found
+}
+
+// absoluteTime is a row stored by SaveAbsoluteTimeToDB.
+type absoluteTime struct {
+	Time       time.Time
+	Containers int
+}
+
+// loadAbsoluteTimes reads the absolute times stored by SaveAbsoluteTimeToDB,
+// i.e. Unix milliseconds in the elapsed column, that have no migration ID.
+func loadAbsoluteTimes(ctx context.Context, conn *pgx.Conn, table string, since time.Time, until time.Time) ([]absoluteTime, error) {
+	rows, err := conn.Query(ctx, fmt.Sprintf("SELECT elapsed, COALESCE(containers, 0) FROM %s WHERE migration_id IS NULL AND elapsed BETWEEN $1 AND $2 ORDER BY elapsed", table),
+		since.UnixMilli(), until.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var times []absoluteTime
+	for rows.Next() {
+		var milliseconds float64
+		var containers int
+		if err := rows.Scan(&milliseconds, &containers); err != nil {
+			return nil, err
+		}
+
+		times = append(times, absoluteTime{Time: time.UnixMilli(int64(milliseconds)), Containers: containers})
+	}
+
+	return times, rows.Err()
+}
+
+// ComputeDowntime analyses the samples of a single target, in time order,
+// around window. The downtime runs from the last success before the first
+// failure to the first success after the last failure, considering failures
+// from the migration start up to margin after the restore end. Latency inflation compares the
+// mean latency of the successful requests in the margin before the migration
+// with the one in the margin after the service recovered.
+func ComputeDowntime(samples []ProbeSample, window MigrationWindow, margin time.Duration) Downtime {
+	downtime := Downtime{Window: window}
+
+	limit := window.End.Add(margin)
+	if window.End.IsZero() {
+		limit = window.Start.Add(margin)
+	}
+
+	firstFailure, lastFailure := -1, -1
+	for i, sample := range samples {
+		if sample.Timestamp.Before(window.Start) || sample.Timestamp.After(limit) {
+			continue
+		}
+
+		if !sample.Success {
+			if firstFailure < 0 {
+				firstFailure = i
+			}
+			lastFailure = i
+		}
+	}
+
+	recovered := window.Start
+	if firstFailure >= 0 {
+		downtime.Interrupted = true
+		downtime.DowntimeStart = samples[firstFailure].Timestamp
+		for i := firstFailure - 1; i >= 0; i-- {
+			if samples[i].Success {
+				downtime.DowntimeStart = samples[i].Timestamp
+				break
+			}
+		}
+
+		downtime.DowntimeEnd = samples[lastFailure].Timestamp
+		for i := lastFailure + 1; i < len(samples); i++ {
+			if samples[i].Success {
+				downtime.DowntimeEnd = samples[i].Timestamp
+				break
+			}
+		}
+
+		for i := firstFailure; i <= lastFailure; i++ {
+			if !samples[i].Success {
+				downtime.FailedRequests++
+			}
+		}
+
+		downtime.Downtime = downtime.DowntimeEnd.Sub(downtime.DowntimeStart)
+		recovered = downtime.DowntimeEnd
+	}
+
+	if !window.End.IsZero() {
+		for _, sample := range samples {
+			if sample.Success && !sample.Timestamp.Before(window.End) {
+				downtime.TimeToFirstSuccess = sample.Timestamp.Sub(window.End)
+				break
+			}
+		}
+
+		if recovered.Before(window.End) {
+			recovered = window.End
+		}
+	}
+
+	downtime.LatencyBefore = meanLatency(samples, window.Start.Add(-margin), window.Start)
+	downtime.LatencyAfter = meanLatency(samples, recovered, recovered.Add(margin))
+	if downtime.LatencyBefore > 0 {
+		downtime.Inflation = float64(downtime.LatencyAfter-downtime.LatencyBefore) / float64(downtime.LatencyBefore)
+	}
+
+	return downtime
+}
+
+// CombinedTarget names the downtime computed over the samples of every
+// target at once.
+const CombinedTarget = "all targets"
+
+// TargetDowntimes holds the downtime of every migration as seen by a target.
+type TargetDowntimes struct {
+	Target    string
+	Downtimes []Downtime
+}
+
+// ComputeTargetDowntimes computes the downtime of every migration for each
+// target, in name order. With several targets, a combined entry merges their
+// samples: the service is then considered down from the first failure of any
+// target to the first success after the last failure of any target.
+func ComputeTargetDowntimes(samples []ProbeSample, windows []MigrationWindow, margin time.Duration) []TargetDowntimes {
+	byTarget := map[string][]ProbeSample{}
+	for _, sample := range samples {
+		byTarget[sample.Target] = append(byTarget[sample.Target], sample)
+	}
+
+	names := make([]string, 0, len(byTarget))
+	for name := range byTarget {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	compute := func(target string, samples []ProbeSample) TargetDowntimes {
+		downtimes := TargetDowntimes{Target: target}
+		for _, window := range windows {
+			downtimes.Downtimes = append(downtimes.Downtimes, ComputeDowntime(samples, window, margin))
+		}
+
+		return downtimes
+	}
+
+	var results []TargetDowntimes
+	for _, name := range names {
+		results = append(results, compute(name, byTarget[name]))
+	}
+
+	if len(names) > 1 {
+		results = append(results, compute(CombinedTarget, samples))
+	}
+
+	return results
+}
+
+func meanLatency(samples []ProbeSample, from time.Time, to time.Time) time.Duration {
+	var sum time.Duration
+	count := 0
+
+	for _, sample := range samples {
+		if sample.Success && !sample.Timestamp.Before(from) && sample.Timestamp.Before(to) {
+			sum += sample.Total
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+
+	return sum / time.Duration(count)
+}
+
+// WriteDowntimes prints one row per migration.
+func WriteDowntimes(w io.Writer, downtimes []Downtime) error {
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "migration\tmigration start\tmigration end\tclock correction\tdowntime\tfailed requests\tfirst success after restore\tlatency before\tlatency after\tinflation")
+
+	for _, d := range downtimes {
+		id := "-"
+		end := "-"
+		correction := "-"
+		firstSuccess := "-"
+		if !d.Window.End.IsZero() {
+			end = d.Window.End.Format("15:04:05.000")
+			firstSuccess = d.TimeToFirstSuccess.String()
+		}
+
+		if d.Window.MigrationID != "" {
+			id = d.Window.MigrationID
+		}
+
+		if d.Window.Corrected {
+			correction = fmt.Sprintf("%v ± %v", -d.Window.ClockOffset, d.Window.Uncertainty)
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%v\t%d\t%s\t%v\t%v\t%+.1f%%\n",
+			id, d.Window.Start.Format("2006-01-02 15:04:05.000"), end, correction, d.Downtime, d.FailedRequests, firstSuccess,
+			d.LatencyBefore, d.LatencyAfter, d.Inflation*100)
+	}
+
+	return writer.Flush()
+}
+
+// WriteTargetDowntimes prints the downtimes of every target under a header.
+func WriteTargetDowntimes(w io.Writer, targets []TargetDowntimes) error {
+	for _, target := range targets {
+		fmt.Fprintf(w, "== %s ==\n", target.Target)
+		if err := WriteDowntimes(w, target.Downtimes); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
@@ -0,0 +1,335 @@
+package latency
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// histogramMagic prefixes every encoded histogram, so that rows written by a
+// different layout are rejected rather than misread.
+const histogramMagic = "HDR1"
+
+// Histogram is a high dynamic range histogram of non-negative integer values,
+// as described by HdrHistogram. Values are grouped in buckets whose width
+// doubles at every power of two, each split in sub-buckets, so that every
+// value is recorded with the given number of significant decimal digits and
+// quantiles stay accurate from the lowest to the highest trackable value.
+type Histogram struct {
+	lowest  int64
+	highest int64
+	digits  int
+
+	unitMagnitude          uint
+	subBucketHalfMagnitude uint
+	subBucketCount         int64
+	subBucketHalfCount     int64
+	subBucketMask          int64
+
+	counts     []int64
+	totalCount int64
+	min        int64
+	max        int64
+	sum        float64
+}
+
+// NewHistogram tracks values between lowest and highest, with digits
+// significant decimal digits (1 to 5).
+func NewHistogram(lowest int64, highest int64, digits int) (*Histogram, error) {
+	if lowest < 1 {
+		return nil, fmt.Errorf("lowest trackable value must be at least 1, got %d", lowest)
+	}
+
+	if highest < 2*lowest {
+		return nil, fmt.Errorf("highest trackable value must be at least twice the lowest, got %d", highest)
+	}
+
+	if digits < 1 || digits > 5 {
+		return nil, fmt.Errorf("significant digits must be between 1 and 5, got %d", digits)
+	}
+
+	largestSingleUnit := 2 * int64(math.Pow10(digits))
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(float64(largestSingleUnit))))
+
+	h := &Histogram{
+		lowest:                 lowest,
+		highest:                highest,
+		digits:                 digits,
+		unitMagnitude:          uint(bits.Len64(uint64(lowest)) - 1),
+		subBucketHalfMagnitude: subBucketCountMagnitude - 1,
+		subBucketCount:         1 << subBucketCountMagnitude,
+		subBucketHalfCount:     1 << (subBucketCountMagnitude - 1),
+		min:                    math.MaxInt64,
+	}
+	h.subBucketMask = (h.subBucketCount - 1) << h.unitMagnitude
+
+	// The first bucket covers the sub-bucket range, every following one
+	// doubles it, until highest fits.
+	bucketCount := 1
+	smallestUntrackable := h.subBucketCount << h.unitMagnitude
+	for smallestUntrackable <= highest && smallestUntrackable <= math.MaxInt64/2 {
+		smallestUntrackable <<= 1
+		bucketCount++
+	}
+
+	h.counts = make([]int64, (bucketCount+1)*int(h.subBucketHalfCount))
+
+	return h, nil
+}
+
+// NewLatencyHistogram tracks durations from 1µs to one minute, in
+// microseconds, with three significant digits.
+func NewLatencyHistogram() *Histogram {
+	h, _ := NewHistogram(1, 60_000_000, 3)
+	return h
+}
+
+func (h *Histogram) bucketIndex(value int64) int {
+	return 64 - bits.LeadingZeros64(uint64(value|h.subBucketMask)) - int(h.unitMagnitude) - int(h.subBucketHalfMagnitude+1)
+}
+
+func (h *Histogram) countsIndex(value int64) int {
+	bucket := h.bucketIndex(value)
+	subBucket := value >> (uint(bucket) + h.unitMagnitude)
+
+	return (bucket+1)<<h.subBucketHalfMagnitude + int(subBucket-h.subBucketHalfCount)
+}
+
+// valueFromIndex returns the lowest value recorded at the given counts index.
+func (h *Histogram) valueFromIndex(index int) int64 {
+	bucket := (index >> h.subBucketHalfMagnitude) - 1
+	subBucket := int64(index&int(h.subBucketHalfCount-1)) + h.subBucketHalfCount
+	if bucket < 0 {
+		subBucket -= h.subBucketHalfCount
+		bucket = 0
+	}
+
+	return subBucket << (uint(bucket) + h.unitMagnitude)
+}
+
+// highestEquivalentValue returns the highest value recorded at the same
+// counts index as value.
+func (h *Histogram) highestEquivalentValue(value int64) int64 {
+	bucket := h.bucketIndex(value)
+	subBucket := value >> (uint(bucket) + h.unitMagnitude)
+
+	adjustedBucket := bucket
+	if subBucket >= h.subBucketCount {
+		adjustedBucket++
+	}
+
+	lowestEquivalent := subBucket << (uint(bucket) + h.unitMagnitude)
+
+	return lowestEquivalent + (int64(1) << (uint(adjustedBucket) + h.unitMagnitude)) - 1
+}
+
+// Record adds value to the histogram. Values above the highest trackable one
+// are clamped to it, so that outliers still count towards the quantiles.
+func (h *Histogram) Record(value int64) {
+	h.RecordN(value, 1)
+}
+
+func (h *Histogram) RecordN(value int64, n int64) {
+	if n <= 0 {
+		return
+	}
+
+	if value < 0 {
+		value = 0
+	}
+
+	if value > h.highest {
+		value = h.highest
+	}
+
+	h.counts[h.countsIndex(value)] += n
+	h.totalCount += n
+	h.sum += float64(value) * float64(n)
+
+	if value < h.min {
+		h.min = value
+	}
+
+	if value > h.max {
+		h.max = value
+	}
+}
+
+func (h *Histogram) TotalCount() int64 {
+	return h.totalCount
+}
+
+func (h *Histogram) Min() int64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+
+	return h.min
+}
+
+func (h *Histogram) Max() int64 {
+	return h.max
+}
+
+func (h *Histogram) Mean() float64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+
+	return h.sum / float64(h.totalCount)
+}
+
+// ValueAtQuantile returns the value below which the fraction q of the recorded
+// values fall, within the precision of the histogram.
+func (h *Histogram) ValueAtQuantile(q float64) int64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+
+	q = math.Min(math.Max(q, 0), 1)
+
+	target := int64(math.Ceil(q * float64(h.totalCount)))
+	if target < 1 {
+		target = 1
+	}
+
+	var seen int64
+	for index, count := range h.counts {
+		seen += count
+		if seen >= target {
+			value := h.highestEquivalentValue(h.valueFromIndex(index))
+			if value > h.max {
+				value = h.max
+			}
+			return value
+		}
+	}
+
+	return h.max
+}
+
+// Merge adds the values recorded in other. Both histograms must share the same
+// layout.
+func (h *Histogram) Merge(other *Histogram) error {
+	if other.lowest != h.lowest || other.highest != h.highest || other.digits != h.digits {
+		return fmt.Errorf("cannot merge a [%d, %d] histogram with %d digits into a [%d, %d] one with %d digits",
+			other.lowest, other.highest, other.digits, h.lowest, h.highest, h.digits)
+	}
+
+	if other.totalCount == 0 {
+		return nil
+	}
+
+	for index, count := range other.counts {
+		h.counts[index] += count
+	}
+
+	h.totalCount += other.totalCount
+	h.sum += other.sum
+
+	if other.min < h.min {
+		h.min = other.min
+	}
+
+	if other.max > h.max {
+		h.max = other.max
+	}
+
+	return nil
+}
+
+// Encode serialises the histogram compactly: the layout, the statistics that
+// cannot be derived from the counts, then the counts as varints where a
+// negative number stands for a run of empty sub-buckets.
+func (h *Histogram) Encode() []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString(histogramMagic)
+
+	scratch := make([]byte, binary.MaxVarintLen64)
+	put := func(value int64) {
+		buffer.Write(scratch[:binary.PutVarint(scratch, value)])
+	}
+
+	put(h.lowest)
+	put(h.highest)
+	put(int64(h.digits))
+	put(h.Min())
+	put(h.max)
+	put(int64(math.Float64bits(h.sum)))
+
+	last := len(h.counts) - 1
+	for last >= 0 && h.counts[last] == 0 {
+		last--
+	}
+	put(int64(last + 1))
+
+	for index := 0; index <= last; {
+		if h.counts[index] != 0 {
+			put(h.counts[index])
+			index++
+			continue
+		}
+
+		zeros := 0
+		for index <= last && h.counts[index] == 0 {
+			zeros++
+			index++
+		}
+		put(-int64(zeros))
+	}
+
+	return buffer.Bytes()
+}
+
+// DecodeHistogram reads a histogram serialised by Encode.
+func DecodeHistogram(data []byte) (*Histogram, error) {
+	if !bytes.HasPrefix(data, []byte(histogramMagic)) {
+		return nil, errors.New("not an encoded histogram")
+	}
+
+	reader := bytes.NewReader(data[len(histogramMagic):])
+	var header [7]int64
+	for i := range header {
+		value, err := binary.ReadVarint(reader)
+		if err != nil {
+			return nil, fmt.Errorf("truncated histogram header: %w", err)
+		}
+		header[i] = value
+	}
+
+	h, err := NewHistogram(header[0], header[1], int(header[2]))
+	if err != nil {
+		return nil, err
+	}
+
+	length := int(header[6])
+	if length < 0 || length > len(h.counts) {
+		return nil, fmt.Errorf("histogram holds %d counts, expected at most %d", length, len(h.counts))
+	}
+
+	for index := 0; index < length; {
+		value, err := binary.ReadVarint(reader)
+		if err != nil {
+			return nil, fmt.Errorf("truncated histogram counts: %w", err)
+		}
+
+		if value < 0 {
+			index += int(-value)
+			continue
+		}
+
+		h.counts[index] = value
+		h.totalCount += value
+		index++
+	}
+
+	if h.totalCount > 0 {
+		h.min, h.max = header[3], header[4]
+	}
+	h.sum = math.Float64frombits(uint64(header[5]))
+
+	return h, nil
+}
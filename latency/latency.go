@@ -2,66 +2,200 @@ package latency
 
 import (
 	"context"
-	"errors"
-	"os/exec"
-	"strings"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/leonardopoggiani/lmo-performance-evaluation/pkg"
 	"github.com/withmandala/go-log"
-	"k8s.io/client-go/kubernetes"
 )
 
-func GetLatency(ctx context.Context, clientset *kubernetes.Clientset, namespace string, db *pgx.Conn, numContainers int, logger *log.Logger) {
-	serviceAddress := "10.110.178.18"
-	logger.Info("Starting latency test")
+// refreshInterval is how often the Service is resolved again while it is
+// reachable. After a failed attempt it is resolved again as well, but not more
+// than once per failureRefreshInterval.
+const (
+	refreshInterval        = 30 * time.Second
+	failureRefreshInterval = time.Second
+)
 
-	for {
-		startTime := time.Now()
-		statusCode := CurlServiceAddress(serviceAddress)
-		elapsed := time.Since(startTime)
+// resultsBuffer is how many attempts can wait to be recorded, maxBatch how
+// many are written to the database at once.
+const (
+	resultsBuffer = 1 << 16
+	maxBatch      = 1000
+)
 
-		if statusCode == "200" {
-			logger.Infof("Successfully reached service at %s with latency: %v\n", serviceAddress, elapsed)
-			pkg.SaveTimeToDB(ctx, db, numContainers, elapsed, "service", "latency", "containers", "elapsed")
-			time.Sleep(time.Second * 1)
-			continue
-		} else {
-			logger.Infof("Unexpected status code from service at %s: %d\n", serviceAddress, statusCode)
+// probedTarget is the state of a target while it is being probed.
+type probedTarget struct {
+	*Target
+	prober      Prober
+	address     string
+	lastRefresh time.Time
+	failing     bool
+}
+
+// start resolves the target and creates its prober.
+func (t *probedTarget) start(ctx context.Context, timeout time.Duration) error {
+	t.address = t.Spec.Address
+	if t.Resolver != nil {
+		address, err := t.Resolver.Resolve(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to resolve service %s/%s: %w", t.Resolver.Namespace, t.Resolver.Name, err)
 		}
+		t.address = address
+	}
 
-		time.Sleep(time.Second * 3)
+	prober, err := NewProber(t.Spec.Probe, t.Spec.Name, t.address, timeout)
+	if err != nil {
+		return err
 	}
+
+	t.prober = prober
+	t.lastRefresh = time.Now()
+
+	return nil
 }
 
-func CurlServiceAddress(serviceAddress string) string {
+// refresh resolves the Service of the target again when it is due, and points
+// the prober to the new address if it changed.
+func (t *probedTarget) refresh(ctx context.Context, success bool, logger *log.Logger) {
+	if t.Resolver == nil {
+		return
+	}
 
-	cmd := exec.Command("curl", "--head", "--silent", "--connect-timeout", "50", "--max-time", "5", "--parallel", "--retry", "100", "--retry-delay", "1", "--retry-all-errors", serviceAddress)
-	output, err := cmd.CombinedOutput()
+	sinceRefresh := time.Since(t.lastRefresh)
+	if sinceRefresh <= refreshInterval && (success || sinceRefresh <= failureRefreshInterval) {
+		return
+	}
 
+	address, changed, err := t.Resolver.Refresh(ctx)
 	if err != nil {
-		return "500"
+		logger.Errorf("Unable to resolve service %s/%s: %v", t.Resolver.Namespace, t.Resolver.Name, err)
+	} else if changed {
+		logger.Infof("Service %s/%s changed, now probing %s", t.Resolver.Namespace, t.Resolver.Name, address)
+		t.address = address
+		t.prober.SetAddress(address)
 	}
+	t.lastRefresh = time.Now()
+}
 
-	statusCode, err := extractStatusCode(output)
-	if err != nil {
-		return "500"
+// track logs when the target becomes unreachable or reachable again, and
+// resolves its Service again when due.
+func (t *probedTarget) track(ctx context.Context, attempt Attempt, logger *log.Logger) {
+	if attempt.Success() {
+		if t.failing {
+			logger.Infof("Target %s at %s reachable again, latency: %v\n", t.Spec.Name, t.address, attempt.Total)
+			t.failing = false
+		}
+	} else if !t.failing {
+		logger.Infof("Failed to reach target %s at %s: %s (%v)\n", t.Spec.Name, t.address, attempt.ErrorClass, attempt.Err)
+		t.failing = true
 	}
 
-	return statusCode
+	t.refresh(ctx, attempt.Success(), logger)
 }
 
-func extractStatusCode(response []byte) (string, error) {
-	lines := strings.Split(string(response), "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "HTTP/") {
-			fields := strings.Fields(line)
-			if len(fields) >= 2 {
-				return strings.Split(fields[1], "/")[0], nil
+// GetLatency probes every target concurrently, each at a constant rate with
+// its own open-loop load generator, until the context is canceled or the
+// configured duration elapses. Attempts are tagged with the target name and
+// stored as rows, aggregated into histograms, or both, depending on record.
+func GetLatency(ctx context.Context, targets []*Target, db *pgx.Conn, numContainers int, options LoadOptions, record RecordOptions, timeout time.Duration, logger *log.Logger) {
+	probed := map[string]*probedTarget{}
+	for _, target := range targets {
+		t := &probedTarget{Target: target}
+		if err := t.start(ctx, timeout); err != nil {
+			logger.Errorf("Skipping target %s: %v", target, err)
+			continue
+		}
+
+		probed[target.Spec.Name] = t
+	}
+
+	if len(probed) == 0 {
+		logger.Error("No target to probe")
+		return
+	}
+
+	// Every generator closes its own channel, the attempts are merged into a
+	// single one so that only this goroutine uses the database connection.
+	// Both are buffered well beyond the concurrency, so that the database
+	// writes never hold back the schedule of the generators.
+	results := make(chan Attempt, resultsBuffer)
+	var generators sync.WaitGroup
+
+	for _, t := range probed {
+		logger.Infof("Starting %s latency test against %s at %s, %.0f req/s, at most %d in flight",
+			t.Spec.Probe, t.Target, t.address, options.Rate, options.Concurrency)
+
+		attempts := make(chan Attempt, resultsBuffer)
+		go func(t *probedTarget) {
+			if unrecorded := Generate(ctx, t.prober, options, attempts); unrecorded > 0 {
+				logger.Errorf("%d dropped attempts to %s were not recorded, the results were not consumed in time", unrecorded, t.Spec.Name)
+			}
+		}(t)
+
+		generators.Add(1)
+		go func() {
+			defer generators.Done()
+			for attempt := range attempts {
+				results <- attempt
+			}
+		}()
+	}
+
+	go func() {
+		generators.Wait()
+		close(results)
+	}()
+
+	var recorder *HistogramRecorder
+	var phases *PhaseTracker
+	if record.HDR() {
+		recorder = NewHistogramRecorder(record.Interval, timeout)
+		phases = NewPhaseTracker(db)
+	}
+
+	var batch []Attempt
+	for attempt := range results {
+		// Whatever queued up meanwhile is written at once.
+		batch = append(batch[:0], attempt)
+	drain:
+		for len(batch) < maxBatch {
+			select {
+			case attempt, ok := <-results:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, attempt)
+			default:
+				break drain
 			}
 		}
+
+		if record.Raw() {
+			SaveAttemptsToDB(ctx, db, numContainers, batch)
+		}
+
+		if recorder != nil {
+			if err := phases.Refresh(ctx); err != nil {
+				logger.Errorf("Unable to load migration windows: %v", err)
+			}
+			for _, attempt := range batch {
+				recorder.Record(attempt, phases.Phase(attempt.Scheduled))
+			}
+			recorder.Flush(ctx, db, numContainers, time.Now(), false)
+		}
+
+		for _, attempt := range batch {
+			probed[attempt.Target].track(ctx, attempt, logger)
+		}
+	}
+
+	if recorder != nil {
+		// The probing context may be canceled already, the remaining buckets
+		// are still worth saving.
+		recorder.Flush(context.Background(), db, numContainers, time.Now(), true)
 	}
 
-	return "500", errors.New("failed to extract status code from response")
+	logger.Info("Latency test completed")
 }
@@ -0,0 +1,115 @@
+package latency
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrorDropped marks an attempt that was due but could not be sent because the
+// concurrency limit was reached. Dropped attempts are recorded, not delayed,
+// so that the schedule stays independent of the response times.
+const ErrorDropped = "dropped"
+
+// Prober sends a single request to a target. SetAddress points it to a new
+// address, e.g. after the Service was resolved again.
+type Prober interface {
+	Target() string
+	SetAddress(address string)
+	Probe(ctx context.Context) Attempt
+}
+
+// LoadOptions configures the open-loop load generator. A zero Duration runs
+// until the context is canceled.
+type LoadOptions struct {
+	Rate        float64
+	Concurrency int
+	Duration    time.Duration
+}
+
+func (o LoadOptions) Validate() error {
+	if o.Rate <= 0 {
+		return fmt.Errorf("rate must be positive, got %v", o.Rate)
+	}
+
+	if o.Concurrency <= 0 {
+		return fmt.Errorf("concurrency must be positive, got %d", o.Concurrency)
+	}
+
+	return nil
+}
+
+// Generate issues attempts at a constant rate, regardless of how long previous
+// attempts take, and sends every outcome to results. Each attempt carries the
+// time it was scheduled at, so late sends are visible rather than hidden. The
+// results channel is closed once every attempt has completed.
+//
+// The schedule never waits for results to be consumed: a dropped attempt that
+// does not fit in results is only counted, and the count is returned.
+func Generate(ctx context.Context, prober Prober, options LoadOptions, results chan<- Attempt) int64 {
+	defer close(results)
+
+	// The duration only stops the schedule, the attempts in flight run to
+	// completion with the parent context rather than failing as timeouts.
+	schedule := ctx
+	if options.Duration > 0 {
+		var cancel context.CancelFunc
+		schedule, cancel = context.WithTimeout(ctx, options.Duration)
+		defer cancel()
+	}
+
+	interval := time.Duration(float64(time.Second) / options.Rate)
+	slots := make(chan struct{}, options.Concurrency)
+	var inFlight sync.WaitGroup
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	scheduled := time.Now()
+	var unrecorded int64
+
+	for {
+		select {
+		case <-schedule.Done():
+			inFlight.Wait()
+			return unrecorded
+		case <-timer.C:
+		}
+
+		// Catch up on every slot that is due, so a stalled loop does not
+		// silently lower the rate.
+		for !scheduled.After(time.Now()) {
+			select {
+			case slots <- struct{}{}:
+				inFlight.Add(1)
+				go func(scheduled time.Time) {
+					defer inFlight.Done()
+					defer func() { <-slots }()
+
+					attempt := prober.Probe(ctx)
+					attempt.Scheduled = scheduled
+					results <- attempt
+				}(scheduled)
+			default:
+				dropped := Attempt{
+					Target:     prober.Target(),
+					Scheduled:  scheduled,
+					Start:      time.Now(),
+					ErrorClass: ErrorDropped,
+					Err:        fmt.Errorf("concurrency limit of %d reached", options.Concurrency),
+				}
+
+				select {
+				case results <- dropped:
+				default:
+					unrecorded++
+				}
+			}
+
+			scheduled = scheduled.Add(interval)
+		}
+
+		timer.Reset(time.Until(scheduled))
+	}
+}
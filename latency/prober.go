@@ -0,0 +1,180 @@
+package latency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Error classes of a failed attempt.
+const (
+	ErrorNone       = ""
+	ErrorDNS        = "dns"
+	ErrorRefused    = "connection_refused"
+	ErrorReset      = "connection_reset"
+	ErrorUnreach    = "unreachable"
+	ErrorTimeout    = "timeout"
+	ErrorHTTPStatus = "http_status"
+	ErrorCanceled   = "canceled"
+	ErrorOther      = "other"
+)
+
+// Attempt is the outcome of a single probe, with the timing breakdown of the
+// request. Phases that did not happen are left to zero. Scheduled is when the
+// load generator meant to send the attempt, which may precede Start.
+type Attempt struct {
+	Target     string
+	Scheduled  time.Time
+	Start      time.Time
+	StatusCode int
+	ErrorClass string
+	Err        error
+	DNS        time.Duration
+	Connect    time.Duration
+	TTFB       time.Duration
+	Total      time.Duration
+}
+
+func (a Attempt) Success() bool {
+	return a.ErrorClass == ErrorNone
+}
+
+// HTTPProber sends a single HEAD request per attempt. Keep-alives are disabled
+// so every attempt opens a new connection, and no retry is ever made.
+type HTTPProber struct {
+	name   string
+	client *http.Client
+
+	mu  sync.RWMutex
+	url string
+}
+
+func NewHTTPProber(name string, address string, timeout time.Duration) *HTTPProber {
+	return &HTTPProber{
+		name: name,
+		url:  httpURL(address),
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:             nil,
+				DisableKeepAlives: true,
+				DialContext:       (&net.Dialer{Timeout: timeout}).DialContext,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// SetAddress points the prober to a new address, e.g. after the Service was
+// resolved again.
+func (p *HTTPProber) SetAddress(address string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.url = httpURL(address)
+}
+
+func (p *HTTPProber) Target() string {
+	return p.name
+}
+
+func httpURL(address string) string {
+	if strings.Contains(address, "://") {
+		return address
+	}
+
+	return "http://" + address
+}
+
+func (p *HTTPProber) Probe(ctx context.Context) Attempt {
+	p.mu.RLock()
+	url := p.url
+	p.mu.RUnlock()
+
+	attempt := Attempt{Target: p.name, Start: time.Now()}
+
+	var dnsStart, connectStart time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			if !dnsStart.IsZero() {
+				attempt.DNS = time.Since(dnsStart)
+			}
+		},
+		ConnectStart: func(string, string) { connectStart = time.Now() },
+		ConnectDone: func(_ string, _ string, err error) {
+			if err == nil && !connectStart.IsZero() {
+				attempt.Connect = time.Since(connectStart)
+			}
+		},
+		GotFirstResponseByte: func() {
+			attempt.TTFB = time.Since(attempt.Start)
+		},
+	}
+
+	request, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodHead, url, nil)
+	if err != nil {
+		attempt.ErrorClass, attempt.Err = ErrorOther, err
+		return attempt
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		attempt.Total = time.Since(attempt.Start)
+		attempt.ErrorClass, attempt.Err = ClassifyError(err), err
+		return attempt
+	}
+
+	_, _ = io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+	attempt.Total = time.Since(attempt.Start)
+
+	// Only a 2xx counts, redirects are not followed.
+	attempt.StatusCode = response.StatusCode
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		attempt.ErrorClass = ErrorHTTPStatus
+		attempt.Err = fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+
+	return attempt
+}
+
+// ClassifyError maps a network error to one of the error classes.
+func ClassifyError(err error) string {
+	var dnsError *net.DNSError
+
+	switch {
+	case err == nil:
+		return ErrorNone
+	case errors.Is(err, context.Canceled):
+		return ErrorCanceled
+	case errors.As(err, &dnsError):
+		return ErrorDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorReset
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return ErrorUnreach
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded), isTimeout(err):
+		return ErrorTimeout
+	default:
+		return ErrorOther
+	}
+}
+
+func isTimeout(err error) bool {
+	var netError net.Error
+	return errors.As(err, &netError) && netError.Timeout()
+}
@@ -0,0 +1,362 @@
+package latency
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// ErrorProtocol marks an attempt that reached the target but got back a reply
+// that does not follow the expected protocol, or a not serving status.
+const ErrorProtocol = "protocol"
+
+// Probe types that can be selected for a target.
+const (
+	ProbeHTTP  = "http"
+	ProbeTCP   = "tcp"
+	ProbeMySQL = "mysql"
+	ProbeGRPC  = "grpc"
+	ProbeUDP   = "udp"
+)
+
+var ProbeTypes = []string{ProbeHTTP, ProbeTCP, ProbeMySQL, ProbeGRPC, ProbeUDP}
+
+// NewProber returns a prober of the given type for address.
+func NewProber(probeType string, name string, address string, timeout time.Duration) (Prober, error) {
+	switch probeType {
+	case ProbeHTTP:
+		return NewHTTPProber(name, address, timeout), nil
+	case ProbeTCP:
+		return &TCPProber{target: newTarget(name, address), timeout: timeout}, nil
+	case ProbeMySQL:
+		return &MySQLProber{target: newTarget(name, address), timeout: timeout}, nil
+	case ProbeGRPC:
+		return &GRPCHealthProber{target: newTarget(name, address), timeout: timeout}, nil
+	case ProbeUDP:
+		return &UDPProber{target: newTarget(name, address), timeout: timeout}, nil
+	default:
+		return nil, fmt.Errorf("unknown probe type %q, expected one of %v", probeType, ProbeTypes)
+	}
+}
+
+// target holds the name and the current address of a probed target.
+type target struct {
+	name string
+
+	mu      sync.RWMutex
+	address string
+}
+
+func newTarget(name string, address string) target {
+	return target{name: name, address: address}
+}
+
+func (t *target) Target() string {
+	return t.name
+}
+
+func (t *target) SetAddress(address string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.address = address
+}
+
+func (t *target) currentAddress() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.address
+}
+
+// dial opens a connection to the current address, recording how long it took
+// in attempt.
+func (t *target) dial(ctx context.Context, network string, timeout time.Duration, attempt *Attempt) (net.Conn, error) {
+	connectStart := time.Now()
+	conn, err := (&net.Dialer{Timeout: timeout}).DialContext(ctx, network, t.currentAddress())
+	if err != nil {
+		attempt.Total = time.Since(attempt.Start)
+		attempt.ErrorClass, attempt.Err = ClassifyError(err), err
+		return nil, err
+	}
+
+	attempt.Connect = time.Since(connectStart)
+	return conn, nil
+}
+
+// fail completes attempt with err, classified unless errorClass is given.
+func fail(attempt *Attempt, errorClass string, err error) Attempt {
+	if errorClass == ErrorNone {
+		errorClass = ClassifyError(err)
+	}
+
+	attempt.Total = time.Since(attempt.Start)
+	attempt.ErrorClass, attempt.Err = errorClass, err
+	return *attempt
+}
+
+// TCPProber only opens a TCP connection and closes it.
+type TCPProber struct {
+	target
+	timeout time.Duration
+}
+
+func (p *TCPProber) Probe(ctx context.Context) Attempt {
+	attempt := Attempt{Target: p.name, Start: time.Now()}
+
+	conn, err := p.dial(ctx, "tcp", p.timeout, &attempt)
+	if err != nil {
+		return attempt
+	}
+	conn.Close()
+
+	attempt.Total = time.Since(attempt.Start)
+	return attempt
+}
+
+// MySQLProber opens a TCP connection and waits for the initial handshake
+// packet of the MySQL protocol, without authenticating. TTFB is the time to
+// the greeting.
+type MySQLProber struct {
+	target
+	timeout time.Duration
+}
+
+func (p *MySQLProber) Probe(ctx context.Context) Attempt {
+	attempt := Attempt{Target: p.name, Start: time.Now()}
+
+	conn, err := p.dial(ctx, "tcp", p.timeout, &attempt)
+	if err != nil {
+		return attempt
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(attempt.Start.Add(p.timeout))
+
+	// Every packet starts with a 3-byte little-endian length and a sequence
+	// number.
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header[:1]); err != nil {
+		return fail(&attempt, ErrorNone, err)
+	}
+	attempt.TTFB = time.Since(attempt.Start)
+
+	if _, err := io.ReadFull(conn, header[1:]); err != nil {
+		return fail(&attempt, ErrorNone, err)
+	}
+
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if length == 0 {
+		return fail(&attempt, ErrorProtocol, errors.New("empty handshake packet"))
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return fail(&attempt, ErrorNone, err)
+	}
+	attempt.Total = time.Since(attempt.Start)
+
+	switch payload[0] {
+	case 0x0a:
+		// Protocol version 10, followed by the NUL-terminated server version.
+	case 0xff:
+		message := ""
+		if len(payload) > 3 {
+			message = string(payload[3:])
+		}
+		attempt.ErrorClass, attempt.Err = ErrorProtocol, fmt.Errorf("server refused the connection: %s", message)
+	default:
+		attempt.ErrorClass, attempt.Err = ErrorProtocol, fmt.Errorf("unexpected protocol version %d", payload[0])
+	}
+
+	return attempt
+}
+
+// grpcServing is the SERVING value of grpc.health.v1.HealthCheckResponse.
+const grpcServing = 1
+
+// GRPCHealthProber calls grpc.health.v1.Health/Check over HTTP/2 without TLS,
+// on a new connection every attempt. The attempt fails unless the server
+// answers SERVING.
+type GRPCHealthProber struct {
+	target
+	timeout time.Duration
+}
+
+func (p *GRPCHealthProber) Probe(ctx context.Context) Attempt {
+	attempt := Attempt{Target: p.name, Start: time.Now()}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network string, address string, _ *tls.Config) (net.Conn, error) {
+			return p.dial(ctx, network, p.timeout, &attempt)
+		},
+	}
+	defer transport.CloseIdleConnections()
+
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			attempt.TTFB = time.Since(attempt.Start)
+		},
+	}
+
+	// An empty HealthCheckRequest asks for the health of the whole server:
+	// the uncompressed flag and a zero length.
+	body := make([]byte, 5)
+
+	request, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodPost,
+		"http://"+p.currentAddress()+"/grpc.health.v1.Health/Check", bytes.NewReader(body))
+	if err != nil {
+		return fail(&attempt, ErrorOther, err)
+	}
+	request.Header.Set("Content-Type", "application/grpc")
+	request.Header.Set("TE", "trailers")
+
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		if attempt.ErrorClass != ErrorNone {
+			return attempt
+		}
+		return fail(&attempt, ErrorNone, err)
+	}
+	defer response.Body.Close()
+
+	attempt.StatusCode = response.StatusCode
+	if response.StatusCode != http.StatusOK {
+		return fail(&attempt, ErrorHTTPStatus, fmt.Errorf("unexpected status code %d", response.StatusCode))
+	}
+
+	reply, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fail(&attempt, ErrorNone, err)
+	}
+	attempt.Total = time.Since(attempt.Start)
+
+	// A trailers-only response carries grpc-status in the headers.
+	status := response.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = response.Header.Get("Grpc-Status")
+	}
+	if status != "0" {
+		attempt.ErrorClass = ErrorProtocol
+		attempt.Err = fmt.Errorf("grpc status %s: %s", status, response.Trailer.Get("Grpc-Message"))
+		return attempt
+	}
+
+	serving, err := parseHealthCheckResponse(reply)
+	if err != nil {
+		attempt.ErrorClass, attempt.Err = ErrorProtocol, err
+	} else if serving != grpcServing {
+		attempt.ErrorClass, attempt.Err = ErrorProtocol, fmt.Errorf("health status %d, not serving", serving)
+	}
+
+	return attempt
+}
+
+// parseHealthCheckResponse returns the status of a length-prefixed
+// HealthCheckResponse, whose only field is the status enum with tag 1.
+func parseHealthCheckResponse(reply []byte) (uint64, error) {
+	if len(reply) < 5 {
+		return 0, fmt.Errorf("short grpc message of %d bytes", len(reply))
+	}
+
+	if reply[0] != 0 {
+		return 0, errors.New("compressed grpc messages are not supported")
+	}
+
+	length := binary.BigEndian.Uint32(reply[1:5])
+	message := reply[5:]
+	if uint32(len(message)) < length {
+		return 0, fmt.Errorf("truncated grpc message, %d of %d bytes", len(message), length)
+	}
+	message = message[:length]
+
+	// An empty message means the default status, UNKNOWN.
+	status := uint64(0)
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, errors.New("malformed health check response")
+		}
+		message = message[n:]
+
+		if key&7 != 0 {
+			return 0, fmt.Errorf("unexpected wire type %d in health check response", key&7)
+		}
+
+		value, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, errors.New("malformed health check response")
+		}
+		message = message[n:]
+
+		if key>>3 == 1 {
+			status = value
+		}
+	}
+
+	return status, nil
+}
+
+// UDPProber sends a random datagram and expects the very same payload back,
+// as an echo server does. Without a connection, a lost datagram is only
+// noticed as a timeout.
+type UDPProber struct {
+	target
+	timeout time.Duration
+}
+
+func (p *UDPProber) Probe(ctx context.Context) Attempt {
+	attempt := Attempt{Target: p.name, Start: time.Now()}
+
+	conn, err := p.dial(ctx, "udp", p.timeout, &attempt)
+	if err != nil {
+		return attempt
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(attempt.Start.Add(p.timeout))
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fail(&attempt, ErrorOther, err)
+	}
+
+	if _, err := conn.Write(nonce); err != nil {
+		return fail(&attempt, ErrorNone, err)
+	}
+
+	reply := make([]byte, 64)
+	for {
+		n, err := conn.Read(reply)
+		if err != nil {
+			return fail(&attempt, ErrorNone, err)
+		}
+
+		// Late replies to earlier attempts cannot reach this socket, but
+		// anything else is ignored until the deadline.
+		if bytes.Equal(reply[:n], nonce) {
+			break
+		}
+	}
+
+	attempt.Total = time.Since(attempt.Start)
+	attempt.TTFB = attempt.Total
+
+	return attempt
+}
@@ -0,0 +1,190 @@
+package latency
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/withmandala/go-log"
+)
+
+// Store modes of the latency command: every attempt as a row, HDR histograms
+// per time bucket and phase, or both.
+const (
+	StoreRaw  = "raw"
+	StoreHDR  = "hdr"
+	StoreBoth = "both"
+)
+
+// Phases a histogram bucket is attributed to.
+const (
+	PhaseSteady    = "steady"
+	PhaseMigration = "migration"
+)
+
+// phaseLookback bounds how far back a migration still in progress is looked
+// for, and phaseRefreshInterval how often the migration windows are read again.
+const (
+	phaseLookback        = 10 * time.Minute
+	phaseRefreshInterval = time.Second
+)
+
+// RecordOptions configures how attempts are persisted.
+type RecordOptions struct {
+	Store    string
+	Interval time.Duration
+}
+
+func (o RecordOptions) Validate() error {
+	switch o.Store {
+	case StoreRaw, StoreHDR, StoreBoth:
+	default:
+		return fmt.Errorf("unknown store mode %q, expected raw, hdr or both", o.Store)
+	}
+
+	if o.Store != StoreRaw && o.Interval <= 0 {
+		return fmt.Errorf("histogram interval must be positive, got %v", o.Interval)
+	}
+
+	return nil
+}
+
+func (o RecordOptions) Raw() bool {
+	return o.Store == StoreRaw || o.Store == StoreBoth
+}
+
+func (o RecordOptions) HDR() bool {
+	return o.Store == StoreHDR || o.Store == StoreBoth
+}
+
+// PhaseTracker tells whether a point in time falls within a migration, using
+// the windows recorded in start_times and back_and_forth_times. A migration
+// without a recorded restore end is considered still in progress. Windows are
+// read again at most once per phaseRefreshInterval, so attempts close to a
+// boundary may be attributed to the wrong phase by up to that interval.
+type PhaseTracker struct {
+	conn        *pgx.Conn
+	windows     []MigrationWindow
+	lastRefresh time.Time
+}
+
+func NewPhaseTracker(conn *pgx.Conn) *PhaseTracker {
+	return &PhaseTracker{conn: conn}
+}
+
+func (t *PhaseTracker) Refresh(ctx context.Context) error {
+	if time.Since(t.lastRefresh) < phaseRefreshInterval {
+		return nil
+	}
+
+	now := time.Now()
+	windows, err := LoadMigrationWindows(ctx, t.conn, now.Add(-phaseLookback), now)
+	t.lastRefresh = now
+	if err != nil {
+		return err
+	}
+
+	t.windows = windows
+	return nil
+}
+
+func (t *PhaseTracker) Phase(at time.Time) string {
+	for _, window := range t.windows {
+		if at.Before(window.Start) {
+			continue
+		}
+
+		if window.End.IsZero() || !at.After(window.End) {
+			return PhaseMigration
+		}
+	}
+
+	return PhaseSteady
+}
+
+type histogramKey struct {
+	start  time.Time
+	target string
+	phase  string
+}
+
+type histogramBucket struct {
+	histogram *Histogram
+	failures  int64
+}
+
+// HistogramRecorder aggregates the latencies of successful attempts, in
+// microseconds, into one histogram per time bucket, target and phase. Failed
+// attempts are only counted. A bucket is saved once no more attempts
+// scheduled within it can arrive.
+type HistogramRecorder struct {
+	interval time.Duration
+	grace    time.Duration
+	buckets  map[histogramKey]*histogramBucket
+}
+
+// NewHistogramRecorder groups attempts in buckets of the given interval.
+// Attempts may complete up to grace after being scheduled.
+func NewHistogramRecorder(interval time.Duration, grace time.Duration) *HistogramRecorder {
+	return &HistogramRecorder{
+		interval: interval,
+		grace:    grace,
+		buckets:  map[histogramKey]*histogramBucket{},
+	}
+}
+
+func (r *HistogramRecorder) Record(attempt Attempt, phase string) {
+	scheduled := attempt.Scheduled
+	if scheduled.IsZero() {
+		scheduled = attempt.Start
+	}
+
+	key := histogramKey{start: scheduled.Truncate(r.interval), target: attempt.Target, phase: phase}
+	bucket, ok := r.buckets[key]
+	if !ok {
+		bucket = &histogramBucket{histogram: NewLatencyHistogram()}
+		r.buckets[key] = bucket
+	}
+
+	if attempt.Success() {
+		bucket.histogram.Record(attempt.Total.Microseconds())
+	} else {
+		bucket.failures++
+	}
+}
+
+// Flush saves and forgets the buckets that ended before now, or every bucket
+// when all is set.
+func (r *HistogramRecorder) Flush(ctx context.Context, conn *pgx.Conn, numContainers int, now time.Time, all bool) {
+	var keys []histogramKey
+	for key := range r.buckets {
+		if all || !key.start.Add(r.interval+r.grace).After(now) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].start.Before(keys[j].start) })
+
+	for _, key := range keys {
+		bucket := r.buckets[key]
+		SaveHistogramToDB(ctx, conn, numContainers, key.start, r.interval, key.target, key.phase, bucket.histogram, bucket.failures)
+		delete(r.buckets, key)
+	}
+}
+
+// SaveHistogramToDB records the encoded histogram of a time bucket in the
+// latency_histograms table.
+func SaveHistogramToDB(ctx context.Context, conn *pgx.Conn, numContainers int, start time.Time, interval time.Duration, target string, phase string, histogram *Histogram, failures int64) {
+	logger := log.New(os.Stderr).WithColor()
+
+	_, err := conn.Exec(ctx, `INSERT INTO latency_histograms
+		(timestamp, duration, target, containers, phase, count, failures, histogram)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		start, interval, target, numContainers, phase, histogram.TotalCount(), failures, histogram.Encode())
+	if err != nil {
+		logger.Error(err)
+	}
+}
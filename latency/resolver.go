@@ -0,0 +1,150 @@
+package latency
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"net"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+//go:embed latency-svc.yaml
+var serviceManifest []byte
+
+// ServiceResolver turns a Service name into an address that can be probed.
+// It remembers the UID of the Service, so that a recreated Service is noticed
+// and resolved again. Port selects a port of the Service by name or number,
+// the first one is used when empty.
+type ServiceResolver struct {
+	Namespace string
+	Name      string
+	Port      string
+
+	clientset *kubernetes.Clientset
+	uid       types.UID
+	address   string
+}
+
+func NewServiceResolver(clientset *kubernetes.Clientset, namespace string, name string) *ServiceResolver {
+	return &ServiceResolver{
+		Namespace: namespace,
+		Name:      name,
+		clientset: clientset,
+	}
+}
+
+// Resolve returns the ClusterIP and port of the Service. Headless Services are
+// resolved to the first ready endpoint instead.
+func (r *ServiceResolver) Resolve(ctx context.Context) (string, error) {
+	service, err := r.clientset.CoreV1().Services(r.Namespace).Get(ctx, r.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	if len(service.Spec.Ports) == 0 {
+		return "", fmt.Errorf("service %s/%s exposes no ports", r.Namespace, r.Name)
+	}
+
+	port, err := r.selectPort(service.Spec.Ports)
+	if err != nil {
+		return "", err
+	}
+
+	address := ""
+	if service.Spec.ClusterIP != "" && service.Spec.ClusterIP != v1.ClusterIPNone {
+		address = net.JoinHostPort(service.Spec.ClusterIP, strconv.Itoa(int(port.Port)))
+	} else {
+		address, err = r.resolveEndpoints(ctx, port.Name)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	r.uid = service.UID
+	r.address = address
+
+	return address, nil
+}
+
+func (r *ServiceResolver) selectPort(ports []v1.ServicePort) (v1.ServicePort, error) {
+	if r.Port == "" {
+		return ports[0], nil
+	}
+
+	for _, port := range ports {
+		if port.Name == r.Port || strconv.Itoa(int(port.Port)) == r.Port {
+			return port, nil
+		}
+	}
+
+	return v1.ServicePort{}, fmt.Errorf("service %s/%s has no port %s", r.Namespace, r.Name, r.Port)
+}
+
+// resolveEndpoints returns the first ready endpoint, on the port named
+// portName when the Service has several.
+func (r *ServiceResolver) resolveEndpoints(ctx context.Context, portName string) (string, error) {
+	endpoints, err := r.clientset.CoreV1().Endpoints(r.Namespace).Get(ctx, r.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) == 0 || len(subset.Ports) == 0 {
+			continue
+		}
+
+		port := subset.Ports[0]
+		for _, candidate := range subset.Ports {
+			if candidate.Name == portName {
+				port = candidate
+			}
+		}
+
+		return net.JoinHostPort(subset.Addresses[0].IP, strconv.Itoa(int(port.Port))), nil
+	}
+
+	return "", fmt.Errorf("service %s/%s has no ready endpoints", r.Namespace, r.Name)
+}
+
+// Refresh resolves the Service again and reports whether the address changed,
+// e.g. because the Service was deleted and recreated.
+func (r *ServiceResolver) Refresh(ctx context.Context) (string, bool, error) {
+	previousUID, previousAddress := r.uid, r.address
+
+	address, err := r.Resolve(ctx)
+	if err != nil {
+		return previousAddress, false, err
+	}
+
+	return address, r.uid != previousUID || address != previousAddress, nil
+}
+
+// CreateService creates the Service bundled in latency-svc.yaml in the given
+// namespace, unless it already exists.
+func CreateService(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (*v1.Service, error) {
+	object, _, err := scheme.Codecs.UniversalDeserializer().Decode(serviceManifest, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	service, ok := object.(*v1.Service)
+	if !ok {
+		return nil, fmt.Errorf("bundled manifest is a %T, not a Service", object)
+	}
+
+	service.Namespace = namespace
+
+	created, err := clientset.CoreV1().Services(namespace).Create(ctx, service, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		return clientset.CoreV1().Services(namespace).Get(ctx, service.Name, metav1.GetOptions{})
+	}
+
+	return created, err
+}
@@ -0,0 +1,110 @@
+package latency
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// TargetSpec describes a target of the latency test, either a Service resolved
+// through the Kubernetes API or a fixed address.
+type TargetSpec struct {
+	Name      string `json:"name"`
+	Service   string `json:"service,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Port      string `json:"port,omitempty"`
+	Address   string `json:"address,omitempty"`
+	Probe     string `json:"probe,omitempty"`
+}
+
+// TargetList is the content of a target list file, e.g.
+//
+//	targets:
+//	  - name: back
+//	    service: back-test-svc
+//	    namespace: back-offloading
+//	  - name: db
+//	    address: 10.0.0.12:3306
+//	    probe: mysql
+type TargetList struct {
+	Targets []TargetSpec `json:"targets"`
+}
+
+// LoadTargets reads a target list file. Targets without a namespace get
+// namespace, targets without a probe type are probed over HTTP, and targets
+// without a name are named after their Service or address.
+func LoadTargets(path string, namespace string) ([]TargetSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	list := TargetList{}
+	if err := yaml.UnmarshalStrict(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if len(list.Targets) == 0 {
+		return nil, fmt.Errorf("%s: no targets", path)
+	}
+
+	names := map[string]bool{}
+	for i := range list.Targets {
+		spec := &list.Targets[i]
+
+		if (spec.Service == "") == (spec.Address == "") {
+			return nil, fmt.Errorf("%s: target %d must set exactly one of service and address", path, i)
+		}
+
+		if spec.Namespace == "" {
+			spec.Namespace = namespace
+		}
+
+		if spec.Probe == "" {
+			spec.Probe = ProbeHTTP
+		}
+
+		if spec.Name == "" {
+			spec.Name = spec.Service + spec.Address
+		}
+
+		if names[spec.Name] {
+			return nil, fmt.Errorf("%s: duplicate target name %q", path, spec.Name)
+		}
+		names[spec.Name] = true
+	}
+
+	return list.Targets, nil
+}
+
+// Target is a target ready to be probed. Resolver is nil for fixed addresses.
+type Target struct {
+	Spec     TargetSpec
+	Resolver *ServiceResolver
+}
+
+// NewTargets prepares the resolvers of the Service targets.
+func NewTargets(clientset *kubernetes.Clientset, specs []TargetSpec) []*Target {
+	targets := make([]*Target, 0, len(specs))
+	for _, spec := range specs {
+		target := &Target{Spec: spec}
+		if spec.Service != "" {
+			target.Resolver = NewServiceResolver(clientset, spec.Namespace, spec.Service)
+			target.Resolver.Port = spec.Port
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets
+}
+
+func (t *Target) String() string {
+	if t.Resolver != nil {
+		return fmt.Sprintf("%s (%s/%s)", t.Spec.Name, t.Spec.Namespace, t.Spec.Service)
+	}
+
+	return fmt.Sprintf("%s (%s)", t.Spec.Name, t.Spec.Address)
+}
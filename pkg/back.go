@@ -2,8 +2,10 @@ package pkg
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -17,19 +19,22 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-func GetBackLatency(ctx context.Context, clientset *kubernetes.Clientset, namespace string, db *pgx.Conn, numContainers int, logger *log.Logger) {
+// GetBackLatency runs the back side of the back-and-forth test until a migration
+// is not received within waitTimeout, the context is canceled, after cleaning
+// up, or an error occurs.
+func GetBackLatency(ctx context.Context, clientset *kubernetes.Clientset, namespace string, db *pgx.Conn, numContainers int, waitTimeout time.Duration, logger *log.Logger) error {
+	defer cleanUpOnCancel(ctx, clientset, logger, namespace, "back-offloading")
+
 	logger.Info("Starting back-and-forth test")
 
 	err := dummy.CreateDummyPod(clientset, ctx, namespace)
 	if err != nil {
-		logger.Errorf(err.Error())
-		return
+		return err
 	}
 
 	err = dummy.CreateDummyService(clientset, ctx, namespace)
 	if err != nil {
-		logger.Errorf(err.Error())
-		return
+		return err
 	}
 
 	_ = DeleteDummyPodAndService(ctx, clientset, "back-offloading", "dummy-pod", "dummy-service")
@@ -37,25 +42,22 @@ func GetBackLatency(ctx context.Context, clientset *kubernetes.Clientset, namesp
 
 	err = dummy.CreateDummyPod(clientset, ctx, namespace)
 	if err != nil {
-		logger.Errorf(err.Error())
-		return
+		return err
 	}
 
 	err = dummy.CreateDummyService(clientset, ctx, namespace)
 	if err != nil {
-		logger.Errorf(err.Error())
-		return
+		return err
 	}
 
 	err = DeletePodsStartingWithTest(ctx, clientset, namespace)
 	if err != nil {
-		logger.Error("Error deleting pods starting with test-")
-		return
+		return fmt.Errorf("error deleting pods starting with test-: %w", err)
 	}
 
 	logger.Info("Creating test pod..")
 	reconciler := controllers.LiveMigrationReconciler{}
-	directory := "/tmp/checkpoints/checkpoints"
+	directory := CheckpointRoot()
 
 	pod := CreateTestContainers(ctx, numContainers, clientset, reconciler, namespace)
 
@@ -65,8 +67,7 @@ func GetBackLatency(ctx context.Context, clientset *kubernetes.Clientset, namesp
 
 	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		logger.Error(err.Error())
-		return
+		return err
 	}
 
 	for _, pod := range pods.Items {
@@ -77,8 +78,7 @@ func GetBackLatency(ctx context.Context, clientset *kubernetes.Clientset, namesp
 			logger.Info("containerStatus.Name: " + containerStatus.Name)
 
 			if len(idParts) < 2 {
-				logger.Error("Malformed container ID")
-				return
+				return fmt.Errorf("malformed container ID %s", containerStatus.ContainerID)
 			}
 			containerID := idParts[1]
 
@@ -92,15 +92,13 @@ func GetBackLatency(ctx context.Context, clientset *kubernetes.Clientset, namesp
 
 	err = controllers.CheckpointPodPipelined(containers, namespace, pod.Name)
 	if err != nil {
-		logger.Error(err.Error())
-		return
+		return err
 	} else {
 		logger.Info("Checkpointing completed")
 	}
 
 	if _, err := exec.Command("sudo", "touch", directory+"/dummy").Output(); err != nil {
-		logger.Error(err.Error())
-		return
+		return err
 	} else {
 		logger.Info("Dummy file created")
 	}
@@ -108,8 +106,7 @@ func GetBackLatency(ctx context.Context, clientset *kubernetes.Clientset, namesp
 	for {
 		files, err := os.ReadDir(directory)
 		if err != nil {
-			logger.Errorf("Error reading directory: %v\n", err)
-			return
+			return fmt.Errorf("error reading directory: %w", err)
 		}
 
 		for _, file := range files {
@@ -122,129 +119,122 @@ func GetBackLatency(ctx context.Context, clientset *kubernetes.Clientset, namesp
 
 		err = reconciler.MigrateCheckpoint(ctx, directory, clientset, "forth-offloading")
 		if err != nil {
-			logger.Error(err.Error())
-			return
+			return err
 		} else {
 			logger.Info("Migration completed")
 		}
 
 		err = DeletePodsStartingWithTest(ctx, clientset, namespace)
 		if err != nil {
-			logger.Error("Error deleting pods starting with test-")
-			return
+			return fmt.Errorf("error deleting pods starting with test-: %w", err)
 		}
 
-		if _, err := exec.Command("sudo", "rm", "-f", directory+"/*").Output(); err != nil {
+		if err := clearDirectory(directory); err != nil {
 			CleanUp(ctx, clientset, pod, namespace)
-			logger.Error(err.Error())
-			logger.Error("Failed to delete checkpoints folder, command: " + "sudo rm -f " + directory + "/*")
-			return
+			return fmt.Errorf("failed to delete checkpoints folder: %w", err)
 		}
 
 		for {
-			if waitForFile(21000*time.Second, directory) {
-				logger.Info("File detected, restoring pod")
+			if err := waitForFile(ctx, waitTimeout, directory); err != nil {
+				return err
+			}
 
-				start := time.Now()
+			logger.Info("File detected, restoring pod")
 
-				pod, err := reconciler.BuildahRestore(ctx, directory, clientset, "back-offloading")
-				if err != nil {
-					logger.Error(err.Error())
-					os.Exit(1)
-				} else {
-					logger.Infof("Pod restored %s", pod.Name)
+			start := time.Now()
 
-					utils.WaitForContainerReady(pod.Name, namespace, pod.Spec.Containers[0].Name, clientset)
+			restored, err := reconciler.BuildahRestore(ctx, directory, clientset, "back-offloading")
+			if err != nil {
+				return err
+			}
 
-					elapsed := time.Since(start)
-					logger.Infof("[MEASURE] Restoring the pod took %d\n", elapsed)
+			logger.Infof("Pod restored %s", restored.Name)
 
-					SaveTimeToDB(ctx, db, len(pod.Spec.Containers), elapsed, "restore", "back_and_forth_times", "containers", "elapsed")
-					if err != nil {
-						logger.Error(err.Error())
-					}
+			utils.WaitForContainerReady(restored.Name, namespace, restored.Spec.Containers[0].Name, clientset)
 
-					_ = exec.Command("sudo", "rm", "/tmp/checkpoints/checkpoints/dummy")
+			elapsed := time.Since(start)
+			logger.Infof("[MEASURE] Restoring the pod took %d\n", elapsed)
 
-					_ = DeleteDummyPodAndService(ctx, clientset, namespace, "dummy-pod", "dummy-service")
-					_ = utils.WaitForPodDeletion(ctx, "dummy-pod", namespace, clientset)
+			SaveTimeToDB(ctx, db, len(restored.Spec.Containers), elapsed, "restore", "back_and_forth_times", "containers", "elapsed")
+			if err != nil {
+				logger.Error(err.Error())
+			}
 
-					err = dummy.CreateDummyPod(clientset, ctx, namespace)
-					if err != nil {
-						logger.Errorf(err.Error())
-						return
-					}
+			if _, err := exec.Command("sudo", "rm", "-f", filepath.Join(directory, "dummy")).Output(); err != nil {
+				CleanUp(ctx, clientset, restored, namespace)
+				return fmt.Errorf("failed to delete the dummy file: %w", err)
+			}
 
-					err = dummy.CreateDummyService(clientset, ctx, namespace)
-					if err != nil {
-						logger.Errorf(err.Error())
-						return
-					}
+			_ = DeleteDummyPodAndService(ctx, clientset, namespace, "dummy-pod", "dummy-service")
+			_ = utils.WaitForPodDeletion(ctx, "dummy-pod", namespace, clientset)
 
-					err = DeletePodsStartingWithTest(ctx, clientset, namespace)
-					if err != nil {
-						logger.Error("Error deleting pods starting with test-")
-						return
-					}
+			err = dummy.CreateDummyPod(clientset, ctx, namespace)
+			if err != nil {
+				return err
+			}
 
-					pod := CreateTestContainers(ctx, numContainers, clientset, reconciler, namespace)
+			err = dummy.CreateDummyService(clientset, ctx, namespace)
+			if err != nil {
+				return err
+			}
 
-					logger.Infof("Checkpointing pod %s", pod.Name)
+			err = DeletePodsStartingWithTest(ctx, clientset, namespace)
+			if err != nil {
+				return fmt.Errorf("error deleting pods starting with test-: %w", err)
+			}
 
-					var containers []types.Container
+			pod := CreateTestContainers(ctx, numContainers, clientset, reconciler, namespace)
 
-					pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
-					if err != nil {
-						logger.Error(err.Error())
-						return
-					}
+			logger.Infof("Checkpointing pod %s", pod.Name)
 
-					for _, pod := range pods.Items {
-						for _, containerStatus := range pod.Status.ContainerStatuses {
-							idParts := strings.Split(containerStatus.ContainerID, "//")
-
-							logger.Info("containerStatus.ContainerID: " + containerStatus.ContainerID)
-							logger.Info("containerStatus.Name: " + containerStatus.Name)
-
-							if len(idParts) < 2 {
-								logger.Error("Malformed container ID")
-								return
-							}
-							containerID := idParts[1]
-
-							container := types.Container{
-								ID:   containerID,
-								Name: containerStatus.Name,
-							}
-							containers = append(containers, container)
-						}
-					}
+			var containers []types.Container
 
-					err = controllers.CheckpointPodPipelined(containers, namespace, pod.Name)
-					if err != nil {
-						logger.Error(err.Error())
-						return
-					} else {
-						logger.Info("Checkpointing completed")
-					}
+			pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return err
+			}
+
+			for _, pod := range pods.Items {
+				for _, containerStatus := range pod.Status.ContainerStatuses {
+					idParts := strings.Split(containerStatus.ContainerID, "//")
+
+					logger.Info("containerStatus.ContainerID: " + containerStatus.ContainerID)
+					logger.Info("containerStatus.Name: " + containerStatus.Name)
 
-					err = reconciler.MigrateCheckpoint(ctx, directory, clientset, "forth-offloading")
-					if err != nil {
-						logger.Error(err.Error())
-						return
-					} else {
-						logger.Info("Migration completed")
+					if len(idParts) < 2 {
+						return fmt.Errorf("malformed container ID %s", containerStatus.ContainerID)
 					}
+					containerID := idParts[1]
 
-					err = DeletePodsStartingWithTest(ctx, clientset, namespace)
-					if err != nil {
-						logger.Error("Error deleting pods starting with test-")
-						return
+					container := types.Container{
+						ID:   containerID,
+						Name: containerStatus.Name,
 					}
+					containers = append(containers, container)
 				}
+			}
+
+			err = controllers.CheckpointPodPipelined(containers, namespace, pod.Name)
+			if err != nil {
+				return err
 			} else {
-				logger.Error("Timeout: File not detected.")
-				os.Exit(1)
+				logger.Info("Checkpointing completed")
+			}
+
+			err = reconciler.MigrateCheckpoint(ctx, directory, clientset, "forth-offloading")
+			if err != nil {
+				return err
+			} else {
+				logger.Info("Migration completed")
+			}
+
+			if err := clearDirectory(directory); err != nil {
+				return fmt.Errorf("failed to delete checkpoints folder: %w", err)
+			}
+
+			err = DeletePodsStartingWithTest(ctx, clientset, namespace)
+			if err != nil {
+				return fmt.Errorf("error deleting pods starting with test-: %w", err)
 			}
 		}
 	}
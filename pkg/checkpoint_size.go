@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -69,14 +68,19 @@ func GetCheckpointSizePipelined(ctx context.Context, clientset *kubernetes.Clien
 		}
 	}
 
-	err = controllers.CheckpointPodPipelined(containers, namespace, pod.Name)
+	trial, err := withTrial("size-pipelined", func() error {
+		return controllers.CheckpointPodPipelined(containers, namespace, pod.Name)
+	})
+	if trial != nil {
+		defer trial.Close()
+	}
 	if err != nil {
 		CleanUp(ctx, clientset, pod, namespace)
 		logger.Error(err.Error())
 		return
 	}
 
-	directory := "/tmp/checkpoints/checkpoints"
+	directory := trial.Directory
 	var size int64 = 0
 
 	err = filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
@@ -107,29 +111,6 @@ func GetCheckpointSizePipelined(ctx context.Context, clientset *kubernetes.Clien
 	logger.Infof("The size of %s is %.2f MB.\n", directory, sizeInMB)
 	SaveSizeToDB(ctx, db, numContainers, sizeInMB, "pipelined", "checkpoint_sizes", "containers", "size")
 
-	// delete checkpoints folder
-	if _, err := exec.Command("sudo", "rm", "-f", directory+"/*").Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		logger.Error("Failed to delete checkpoints folder, command: " + "sudo rm -f " + directory + "/*")
-		return
-	}
-
-	if _, err = exec.Command("sudo", "mkdir", "/tmp/checkpoints/checkpoints/").Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		return
-	}
-
-	// check that checkpoints folder is empty
-	if output, err := exec.Command("sudo", "ls", directory).Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		return
-	} else {
-		fmt.Printf("Output: %s\n", output)
-	}
-
 	CleanUp(ctx, clientset, pod, namespace)
 }
 
@@ -186,14 +167,19 @@ func GetCheckpointSizeSequential(ctx context.Context, clientset *kubernetes.Clie
 		}
 	}
 
-	err = reconciler.CheckpointPodCrio(containers, namespace, pod.Name)
+	trial, err := withTrial("size-sequential", func() error {
+		return reconciler.CheckpointPodCrio(containers, namespace, pod.Name)
+	})
+	if trial != nil {
+		defer trial.Close()
+	}
 	if err != nil {
 		logger.Errorf(err.Error())
 		CleanUp(ctx, clientset, pod, namespace)
 		return
 	}
 
-	directory := "/tmp/checkpoints/checkpoints"
+	directory := trial.Directory
 	var size int64 = 0
 
 	err = filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
@@ -219,27 +205,5 @@ func GetCheckpointSizeSequential(ctx context.Context, clientset *kubernetes.Clie
 	fmt.Printf("The size of %s is %.2f MB.\n", directory, sizeInMB)
 	SaveSizeToDB(ctx, db, numContainers, sizeInMB, "sequential", "checkpoint_sizes", "containers", "size")
 
-	// delete checkpoints folder
-	if _, err := exec.Command("sudo", "rm", "-f", directory+"/").Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		return
-	}
-
-	if _, err = exec.Command("sudo", "mkdir", "/tmp/checkpoints/checkpoints/").Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		return
-	}
-
-	// check that checkpoints folder is empty
-	if output, err := exec.Command("sudo", "ls", directory).Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		return
-	} else {
-		fmt.Printf("Output: %s\n", output)
-	}
-
 	CleanUp(ctx, clientset, pod, namespace)
 }
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -66,34 +65,26 @@ func GetCheckpointTimeSequential(ctx context.Context, clientset *kubernetes.Clie
 		}
 	}
 
-	// Get the start time of the checkpoint
-	start := time.Now()
-
-	err = reconciler.CheckpointPodCrio(containers, namespace, pod.Name)
+	var elapsed time.Duration
+	trial, err := withTrial("checkpoint-sequential", func() error {
+		start := time.Now()
+		err := reconciler.CheckpointPodCrio(containers, namespace, pod.Name)
+		elapsed = time.Since(start)
+		return err
+	})
+	if trial != nil {
+		defer trial.Close()
+	}
 	if err != nil {
+		CleanUp(ctx, clientset, pod, namespace)
+		logger.Error(err.Error())
 		return
 	}
 
-	// Calculate the time taken for the checkpoint
-	elapsed := time.Since(start)
 	fmt.Println("Elapsed sequential: ", elapsed)
 
 	SaveTimeToDB(ctx, db, numContainers, elapsed, "sequential", "checkpoint_times", "containers", "elapsed")
 
-	// delete checkpoint folder
-	directory := "/tmp/checkpoints/checkpoints"
-	if _, err := exec.Command("sudo", "rm", "-rf", directory+"/").Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		return
-	}
-
-	if _, err = exec.Command("sudo", "mkdir", "/tmp/checkpoints/checkpoints/").Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		return
-	}
-
 	CleanUp(ctx, clientset, pod, namespace)
 }
 
@@ -144,30 +135,25 @@ func GetCheckpointTimePipelined(ctx context.Context, clientset *kubernetes.Clien
 		}
 	}
 
-	start := time.Now()
-
-	err = controllers.CheckpointPodPipelined(containers, namespace, pod.Name)
+	var elapsed time.Duration
+	trial, err := withTrial("checkpoint-pipelined", func() error {
+		start := time.Now()
+		err := controllers.CheckpointPodPipelined(containers, namespace, pod.Name)
+		elapsed = time.Since(start)
+		return err
+	})
+	if trial != nil {
+		defer trial.Close()
+	}
 	if err != nil {
+		CleanUp(ctx, clientset, pod, namespace)
+		logger.Error(err.Error())
 		return
 	}
 
-	elapsed := time.Since(start)
 	fmt.Println("Elapsed pipelined: ", elapsed)
 
 	SaveTimeToDB(ctx, db, numContainers, elapsed, "pipelined", "checkpoint_times", "containers", "elapsed")
 
-	directory := "/tmp/checkpoints/checkpoints"
-	if _, err := exec.Command("sudo", "rm", "-rf", directory+"/").Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		return
-	}
-
-	if _, err = exec.Command("sudo", "mkdir", "/tmp/checkpoints/checkpoints/").Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		return
-	}
-
 	CleanUp(ctx, clientset, pod, namespace)
 }
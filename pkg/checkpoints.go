@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/withmandala/go-log"
+)
+
+// DefaultCheckpointRoot is where the operator writes the checkpoint archives,
+// and the checkpoint root unless CHECKPOINTS_FOLDER says otherwise.
+const DefaultCheckpointRoot = "/tmp/checkpoints/checkpoints"
+
+// CheckpointRoot returns the checkpoint root set in CHECKPOINTS_FOLDER.
+func CheckpointRoot() string {
+	if root := os.Getenv("CHECKPOINTS_FOLDER"); root != "" {
+		return root
+	}
+
+	return DefaultCheckpointRoot
+}
+
+// KeepFailedCheckpoints reports whether KEEP_FAILED_CHECKPOINTS asks to keep
+// the directories of the failed trials for a post-mortem.
+func KeepFailedCheckpoints() bool {
+	keep, _ := strconv.ParseBool(os.Getenv("KEEP_FAILED_CHECKPOINTS"))
+	return keep
+}
+
+// Trial is the checkpoint directory of a single trial, a subdirectory of the
+// checkpoint root named after the trial. The checkpoint is still written to the
+// root: Collect moves what it wrote into the trial directory.
+type Trial struct {
+	ID        string
+	Directory string
+
+	root     string
+	existing map[string]bool
+	failed   bool
+}
+
+// NewTrial creates an empty directory for the trial id in the checkpoint root.
+// The entries already in the root, e.g. the directories of the failed trials
+// kept so far, are left alone by Collect.
+func NewTrial(id string) (*Trial, error) {
+	trial := OpenTrial(id)
+
+	// The operator always writes to its own folder, Collect would find
+	// nothing in another root.
+	if filepath.Clean(trial.root) != DefaultCheckpointRoot {
+		return nil, fmt.Errorf("CHECKPOINTS_FOLDER is %s but the operator writes the checkpoints to %s", trial.root, DefaultCheckpointRoot)
+	}
+
+	if _, err := exec.Command("sudo", "rm", "-rf", trial.Directory).Output(); err != nil {
+		return nil, fmt.Errorf("unable to delete %s: %w", trial.Directory, err)
+	}
+
+	if _, err := exec.Command("sudo", "mkdir", "-p", trial.Directory).Output(); err != nil {
+		return nil, fmt.Errorf("unable to create %s: %w", trial.Directory, err)
+	}
+
+	entries, err := os.ReadDir(trial.root)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		trial.existing[entry.Name()] = true
+	}
+
+	return trial, nil
+}
+
+// OpenTrial returns the trial of a directory of the checkpoint root, e.g. one
+// received from the sender, without creating it.
+func OpenTrial(id string) *Trial {
+	root := CheckpointRoot()
+
+	return &Trial{
+		ID:        id,
+		Directory: filepath.Join(root, id),
+		root:      root,
+		existing:  map[string]bool{},
+	}
+}
+
+// newTrialID names a trial of the synthetic experiments after its kind and
+// the current time.
+func newTrialID(kind string) string {
+	return fmt.Sprintf("%s-%s", kind, time.Now().Format("20060102-150405.000000"))
+}
+
+// withTrial checkpoints into a new trial of kind and collects the archives,
+// even after a failed checkpoint, in which case the trial is marked failed.
+// The trial is nil when it could not be created, the caller closes it
+// otherwise.
+func withTrial(kind string, checkpoint func() error) (*Trial, error) {
+	trial, err := NewTrial(newTrialID(kind))
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkpoint()
+	if collectErr := trial.Collect(); err == nil {
+		err = collectErr
+	}
+	if err != nil {
+		trial.Fail()
+	}
+
+	return trial, err
+}
+
+// Collect moves the entries written to the checkpoint root since the trial
+// started into the trial directory. It is meant to be called right after the
+// checkpoint, even a failed one, so that nothing is left in the root.
+func (t *Trial) Collect() error {
+	entries, err := os.ReadDir(t.root)
+	if err != nil {
+		return err
+	}
+
+	// The archives written by CRIU belong to root, like the root itself.
+	args := []string{"mv", "--"}
+	for _, entry := range entries {
+		if !t.existing[entry.Name()] {
+			args = append(args, filepath.Join(t.root, entry.Name()))
+		}
+	}
+
+	if len(args) == 2 {
+		return nil
+	}
+
+	args = append(args, t.Directory)
+	if output, err := exec.Command("sudo", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to move the archives to %s: %w: %s", t.Directory, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// Fail marks the trial failed, so that Close keeps its directory when
+// KEEP_FAILED_CHECKPOINTS is set.
+func (t *Trial) Fail() {
+	t.failed = true
+}
+
+// Failed reports whether the trial was marked failed.
+func (t *Trial) Failed() bool {
+	return t.failed
+}
+
+// Close removes the trial directory, unless the trial failed and the failed
+// ones are kept.
+func (t *Trial) Close() {
+	logger := log.New(os.Stderr).WithColor()
+
+	if t.failed && KeepFailedCheckpoints() {
+		logger.Infof("Trial %s failed, its checkpoints are kept in %s", t.ID, t.Directory)
+		return
+	}
+
+	if _, err := exec.Command("sudo", "rm", "-rf", t.Directory).Output(); err != nil {
+		logger.Errorf("Unable to delete %s: %v", t.Directory, err)
+	}
+}
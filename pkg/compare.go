@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
 	"time"
@@ -60,7 +59,12 @@ func GetTriangularizedTime(ctx context.Context, clientset *kubernetes.Clientset,
 		}
 	}
 
-	err = reconciler.CheckpointPodCrio(containers, namespace, pod.Name)
+	trial, err := withTrial("triangularized", func() error {
+		return reconciler.CheckpointPodCrio(containers, namespace, pod.Name)
+	})
+	if trial != nil {
+		defer trial.Close()
+	}
 	if err != nil {
 		logger.Errorf(err.Error())
 		CleanUp(ctx, clientset, pod, namespace)
@@ -71,8 +75,9 @@ func GetTriangularizedTime(ctx context.Context, clientset *kubernetes.Clientset,
 
 	start := time.Now()
 
-	pod, err = reconciler.BuildahRestore(ctx, "/tmp/checkpoints/checkpoints", clientset, namespace)
+	pod, err = reconciler.BuildahRestore(ctx, trial.Directory, clientset, namespace)
 	if err != nil {
+		trial.Fail()
 		logger.Errorf(err.Error())
 		return
 	}
@@ -129,18 +134,5 @@ func GetTriangularizedTime(ctx context.Context, clientset *kubernetes.Clientset,
 
 	SaveTimeToDB(ctx, db, numContainers, elapsed, "triangularized", "triangularized_times", "containers", "elapsed")
 
-	directory := "/tmp/checkpoints/checkpoints"
-	if _, err := exec.Command("sudo", "rm", "-rf", directory+"/").Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		return
-	}
-
-	if _, err = exec.Command("sudo", "mkdir", "/tmp/checkpoints/checkpoints/").Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		return
-	}
-
 	CleanUp(ctx, clientset, pod, namespace)
 }
@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"strings"
@@ -17,7 +18,12 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-func GetForthLatency(ctx context.Context, clientset *kubernetes.Clientset, namespace string, db *pgx.Conn, numContainers int, logger *log.Logger) {
+// GetForthLatency runs the forth side of the back-and-forth test until a migration
+// is not received within waitTimeout, the context is canceled, after cleaning
+// up, or an error occurs.
+func GetForthLatency(ctx context.Context, clientset *kubernetes.Clientset, namespace string, db *pgx.Conn, numContainers int, waitTimeout time.Duration, logger *log.Logger) error {
+	defer cleanUpOnCancel(ctx, clientset, logger, namespace, "forth-offloading")
+
 	logger.Info("Starting back-and-forth test")
 
 	for {
@@ -29,173 +35,163 @@ func GetForthLatency(ctx context.Context, clientset *kubernetes.Clientset, names
 
 		err = dummy.CreateDummyPod(clientset, ctx, "forth-offloading")
 		if err != nil {
-			logger.Errorf(err.Error())
-			return
+			return err
 		}
 
 		err = dummy.CreateDummyService(clientset, ctx, "forth-offloading")
 		if err != nil {
-			logger.Errorf(err.Error())
-			return
+			return err
 		}
 
 		logger.Info("Starting forth receiver")
-		directory := "/tmp/checkpoints/checkpoints"
+		directory := CheckpointRoot()
 		reconciler := controllers.LiveMigrationReconciler{}
 
+		// A dummy left by an earlier run would start the restore right away.
+		if err := clearDirectory(directory); err != nil {
+			return fmt.Errorf("failed to delete checkpoints folder: %w", err)
+		}
+
 		for {
-			if waitForFile(21000*time.Second, directory) {
-				logger.Info("File detected, restoring pod")
+			if err := waitForFile(ctx, waitTimeout, directory); err != nil {
+				return err
+			}
 
-				start := time.Now()
+			logger.Info("File detected, restoring pod")
 
-				pod, err := reconciler.BuildahRestore(ctx, directory, clientset, "forth-offloading")
-				if err != nil {
-					logger.Error(err.Error())
-					os.Exit(1)
-				} else {
-					logger.Infof("Pod restored %s", pod.Name)
+			start := time.Now()
 
-					utils.WaitForContainerReady(pod.Name, namespace, pod.Spec.Containers[0].Name, clientset)
+			restored, err := reconciler.BuildahRestore(ctx, directory, clientset, "forth-offloading")
+			if err != nil {
+				return err
+			}
 
-					elapsed := time.Since(start)
-					logger.Infof("[MEASURE] Restoring the pod took %d\n", elapsed)
+			logger.Infof("Pod restored %s", restored.Name)
 
-					SaveTimeToDB(ctx, db, len(pod.Spec.Containers), elapsed, "restore", "back_and_forth_times", "containers", "elapsed")
-					if err != nil {
-						logger.Error(err.Error())
-					}
+			utils.WaitForContainerReady(restored.Name, namespace, restored.Spec.Containers[0].Name, clientset)
 
-					err = DeletePodsStartingWithTest(ctx, clientset, namespace)
-					if err != nil {
-						logger.Error("Error deleting pods starting with test-")
-						return
-					}
+			elapsed := time.Since(start)
+			logger.Infof("[MEASURE] Restoring the pod took %d\n", elapsed)
 
-					// delete checkpoints folder
-					if _, err := exec.Command("sudo", "rm", "-f", directory+"/*").Output(); err != nil {
-						CleanUp(ctx, clientset, pod, namespace)
-						logger.Error(err.Error())
-						logger.Error("Failed to delete checkpoints folder, command: " + "sudo rm -f " + directory + "/*")
-						return
-					}
+			SaveTimeToDB(ctx, db, len(restored.Spec.Containers), elapsed, "restore", "back_and_forth_times", "containers", "elapsed")
+			if err != nil {
+				logger.Error(err.Error())
+			}
 
-					pod := CreateTestContainers(ctx, numContainers, clientset, reconciler, namespace)
+			err = DeletePodsStartingWithTest(ctx, clientset, namespace)
+			if err != nil {
+				return fmt.Errorf("error deleting pods starting with test-: %w", err)
+			}
 
-					logger.Infof("Checkpointing pod %s", pod.Name)
+			// delete checkpoints folder
+			if err := clearDirectory(directory); err != nil {
+				CleanUp(ctx, clientset, restored, namespace)
+				return fmt.Errorf("failed to delete checkpoints folder: %w", err)
+			}
 
-					var containers []types.Container
+			pod := CreateTestContainers(ctx, numContainers, clientset, reconciler, namespace)
 
-					pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
-					if err != nil {
-						logger.Error(err.Error())
-						return
-					}
+			logger.Infof("Checkpointing pod %s", pod.Name)
 
-					for _, pod := range pods.Items {
-						for _, containerStatus := range pod.Status.ContainerStatuses {
-							idParts := strings.Split(containerStatus.ContainerID, "//")
-
-							logger.Info("containerStatus.ContainerID: " + containerStatus.ContainerID)
-							logger.Info("containerStatus.Name: " + containerStatus.Name)
-
-							if len(idParts) < 2 {
-								logger.Error("Malformed container ID")
-								return
-							}
-							containerID := idParts[1]
-
-							container := types.Container{
-								ID:   containerID,
-								Name: containerStatus.Name,
-							}
-							containers = append(containers, container)
-						}
-					}
+			var containers []types.Container
 
-					logger.Infof("Checkpointing pod %s", pod.Name)
-					err = controllers.CheckpointPodPipelined(containers, namespace, pod.Name)
-					if err != nil {
-						logger.Error(err.Error())
-						return
-					} else {
-						logger.Info("Checkpointing completed")
-					}
+			pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return err
+			}
 
-					if _, err := exec.Command("sudo", "touch", directory+"/dummy").Output(); err != nil {
-						logger.Error(err.Error())
-						return
-					} else {
-						logger.Info("Dummy file created")
-					}
+			for _, pod := range pods.Items {
+				for _, containerStatus := range pod.Status.ContainerStatuses {
+					idParts := strings.Split(containerStatus.ContainerID, "//")
+
+					logger.Info("containerStatus.ContainerID: " + containerStatus.ContainerID)
+					logger.Info("containerStatus.Name: " + containerStatus.Name)
 
-					files, err := os.ReadDir(directory)
-					if err != nil {
-						logger.Errorf("Error reading directory: %v\n", err)
-						return
+					if len(idParts) < 2 {
+						return fmt.Errorf("malformed container ID %s", containerStatus.ContainerID)
 					}
+					containerID := idParts[1]
 
-					for _, file := range files {
-						if file.IsDir() {
-							logger.Infof("Directory: %s\n", file.Name())
-						} else {
-							logger.Infof("File: %s\n", file.Name())
-						}
+					container := types.Container{
+						ID:   containerID,
+						Name: containerStatus.Name,
 					}
+					containers = append(containers, container)
+				}
+			}
 
-					_ = DeleteDummyPodAndService(ctx, clientset, namespace, "dummy-pod", "dummy-service")
-					_ = utils.WaitForPodDeletion(ctx, "dummy-pod", namespace, clientset)
+			logger.Infof("Checkpointing pod %s", pod.Name)
+			err = controllers.CheckpointPodPipelined(containers, namespace, pod.Name)
+			if err != nil {
+				return err
+			} else {
+				logger.Info("Checkpointing completed")
+			}
 
-					err = dummy.CreateDummyPod(clientset, ctx, namespace)
-					if err != nil {
-						logger.Errorf(err.Error())
-						return
-					}
+			if _, err := exec.Command("sudo", "touch", directory+"/dummy").Output(); err != nil {
+				return err
+			} else {
+				logger.Info("Dummy file created")
+			}
 
-					err = dummy.CreateDummyService(clientset, ctx, namespace)
-					if err != nil {
-						logger.Errorf(err.Error())
-						return
-					}
+			files, err := os.ReadDir(directory)
+			if err != nil {
+				return fmt.Errorf("error reading directory: %w", err)
+			}
 
-					err = reconciler.MigrateCheckpoint(ctx, directory, clientset, "back-offloading")
-					if err != nil {
-						logger.Error(err.Error())
-						return
-					} else {
-						logger.Info("Migration completed")
-					}
+			for _, file := range files {
+				if file.IsDir() {
+					logger.Infof("Directory: %s\n", file.Name())
+				} else {
+					logger.Infof("File: %s\n", file.Name())
+				}
+			}
 
-					err = DeletePodsStartingWithTest(ctx, clientset, namespace)
-					if err != nil {
-						logger.Error("Error deleting pods starting with test-")
-						return
-					}
+			_ = DeleteDummyPodAndService(ctx, clientset, namespace, "dummy-pod", "dummy-service")
+			_ = utils.WaitForPodDeletion(ctx, "dummy-pod", namespace, clientset)
 
-					_ = DeleteDummyPodAndService(ctx, clientset, namespace, "dummy-pod", "dummy-service")
-					_ = utils.WaitForPodDeletion(ctx, "dummy-pod", namespace, clientset)
+			err = dummy.CreateDummyPod(clientset, ctx, namespace)
+			if err != nil {
+				return err
+			}
 
-					err = dummy.CreateDummyPod(clientset, ctx, namespace)
-					if err != nil {
-						logger.Errorf(err.Error())
-						return
-					}
+			err = dummy.CreateDummyService(clientset, ctx, namespace)
+			if err != nil {
+				return err
+			}
 
-					err = dummy.CreateDummyService(clientset, ctx, namespace)
-					if err != nil {
-						logger.Errorf(err.Error())
-						return
-					}
-				}
+			err = reconciler.MigrateCheckpoint(ctx, directory, clientset, "back-offloading")
+			if err != nil {
+				return err
 			} else {
-				logger.Error("Timeout: File not detected.")
-				os.Exit(1)
+				logger.Info("Migration completed")
+			}
+
+			if err := clearDirectory(directory); err != nil {
+				return fmt.Errorf("failed to delete checkpoints folder: %w", err)
+			}
+
+			err = DeletePodsStartingWithTest(ctx, clientset, namespace)
+			if err != nil {
+				return fmt.Errorf("error deleting pods starting with test-: %w", err)
+			}
+
+			_ = DeleteDummyPodAndService(ctx, clientset, namespace, "dummy-pod", "dummy-service")
+			_ = utils.WaitForPodDeletion(ctx, "dummy-pod", namespace, clientset)
+
+			err = dummy.CreateDummyPod(clientset, ctx, namespace)
+			if err != nil {
+				return err
+			}
+
+			err = dummy.CreateDummyService(clientset, ctx, namespace)
+			if err != nil {
+				return err
 			}
 
-			err := DeletePodsStartingWithTest(ctx, clientset, namespace)
+			err = DeletePodsStartingWithTest(ctx, clientset, namespace)
 			if err != nil {
-				logger.Error("Error deleting pods starting with test-")
-				return
+				return fmt.Errorf("error deleting pods starting with test-: %w", err)
 			}
 		}
 	}
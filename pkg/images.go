@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
 
@@ -60,15 +59,18 @@ func GetCheckpointImageRestoreSize(ctx context.Context, clientset *kubernetes.Cl
 		}
 	}
 
-	err = reconciler.CheckpointPodCrio(containers, namespace, pod.Name)
+	trial, err := withTrial("image-size", func() error {
+		return reconciler.CheckpointPodCrio(containers, namespace, pod.Name)
+	})
+	if trial != nil {
+		defer trial.Close()
+	}
 	if err != nil {
 		logger.Errorf(err.Error())
 		CleanUp(ctx, clientset, pod, namespace)
 		return
 	}
 
-	directory := "/tmp/checkpoints/checkpoints"
-
 	for i := 0; i < numContainers; i++ {
 		// Get the image name
 		imageName := "localhost/leonardopoggiani/checkpoint-images:container-" + strconv.Itoa(i)
@@ -82,21 +84,5 @@ func GetCheckpointImageRestoreSize(ctx context.Context, clientset *kubernetes.Cl
 		fmt.Printf("The size of %s is %.2f MB.\n", imageName, sizeInMB)
 	}
 
-	// delete checkpoints folder
-	if _, err := exec.Command("sudo", "rm", "-f", directory+"/").Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		return
-	}
-
-	// check that checkpoints folder is empty
-	if output, err := exec.Command("sudo", "ls", directory).Output(); err != nil {
-		CleanUp(ctx, clientset, pod, namespace)
-		logger.Error(err.Error())
-		return
-	} else {
-		fmt.Printf("Output: %s\n", output)
-	}
-
 	CleanUp(ctx, clientset, pod, namespace)
 }
@@ -0,0 +1,141 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/control"
+	"github.com/withmandala/go-log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// firstRequestTimeout bounds how long the receiver waits for the restored pod
+// to answer its first request.
+const firstRequestTimeout = 30 * time.Second
+
+// phaseLog collects the phases of a migration measured on this host.
+type phaseLog struct {
+	phases []control.Phase
+}
+
+func (l *phaseLog) start(name string) {
+	l.phases = append(l.phases, control.Phase{Name: name, Start: time.Now()})
+}
+
+// end completes the last phase started.
+func (l *phaseLog) end(err error) {
+	if len(l.phases) == 0 {
+		return
+	}
+
+	phase := &l.phases[len(l.phases)-1]
+	phase.End = time.Now()
+	if err != nil {
+		phase.Error = err.Error()
+	}
+}
+
+// SavePhasesToDB records the phases of a migration measured by host, sender or
+// receiver, in the migration_phases table. Start and end are read from the
+// clock of that host.
+func SavePhasesToDB(ctx context.Context, conn *pgx.Conn, migrationID string, host string, phases []control.Phase) {
+	logger := log.New(os.Stderr).WithColor()
+
+	for i, phase := range phases {
+		var end *time.Time
+		if !phase.End.IsZero() {
+			end = &phase.End
+		}
+
+		_, err := conn.Exec(ctx, `INSERT INTO migration_phases (migration_id, host, seq, phase, started, finished, error)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))`,
+			migrationID, host, i, phase.Name, phase.Start, end, phase.Error)
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+	}
+}
+
+// watchPodCreation reports when the first pod whose name matches is created
+// in namespace from now on. It is used to tell the image build of
+// BuildahRestore apart from the creation of the pod. Nothing is sent if the
+// context is done first.
+func watchPodCreation(ctx context.Context, clientset *kubernetes.Clientset, namespace string, match func(name string) bool) (<-chan time.Time, error) {
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Starting from the version of the list skips the pods that already exist.
+	watcher, err := clientset.CoreV1().Pods(namespace).Watch(ctx, metav1.ListOptions{ResourceVersion: pods.ResourceVersion})
+	if err != nil {
+		return nil, err
+	}
+
+	created := make(chan time.Time, 1)
+	go func() {
+		defer watcher.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.ResultChan():
+				if !ok {
+					return
+				}
+
+				if event.Type != watch.Added {
+					continue
+				}
+
+				if object, ok := event.Object.(metav1.Object); ok && match(object.GetName()) {
+					created <- time.Now()
+					return
+				}
+			}
+		}
+	}()
+
+	return created, nil
+}
+
+// waitForFirstRequest sends HTTP requests to url until one gets a 2xx
+// response, or timeout expires.
+func waitForFirstRequest(ctx context.Context, url string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client := &http.Client{Timeout: time.Second}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		response, err := client.Do(request)
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode >= 200 && response.StatusCode < 300 {
+				return nil
+			}
+			err = fmt.Errorf("status code %d", response.StatusCode)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("no successful response from %s within %v: %w", url, timeout, err)
+		case <-ticker.C:
+		}
+	}
+}
@@ -2,9 +2,14 @@ package pkg
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -13,68 +18,220 @@ import (
 	controllers "github.com/leonardopoggiani/live-migration-operator/controllers"
 	"github.com/leonardopoggiani/live-migration-operator/controllers/dummy"
 	utils "github.com/leonardopoggiani/live-migration-operator/controllers/utils"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/control"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/transfer"
 	"github.com/withmandala/go-log"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-func waitForFile(timeout time.Duration, path string) bool {
+// DefaultWaitTimeout is how long the receivers wait for the next migration
+// unless configured otherwise.
+const DefaultWaitTimeout = 21000 * time.Second
+
+// cleanUpTimeout bounds the clean up done after the context was canceled.
+const cleanUpTimeout = 30 * time.Second
+
+// waitForFile waits for the dummy file to be created in path. It gives up
+// after timeout or when the context is canceled.
+func waitForFile(ctx context.Context, timeout time.Duration, path string) error {
 	logger := log.New(os.Stderr).WithColor()
 
 	filePath := filepath.Join(path, "dummy")
 
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(path); err != nil {
+		return fmt.Errorf("failed to add watcher: %w", err)
+	}
+
+	// The file may have been created before the watch started. The directory
+	// is cleared before every wait, so a dummy found here is the peer's.
+	if _, err := os.Stat(filePath); err == nil {
+		logger.Info("File 'dummy' detected.")
+		return nil
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
 	for {
-		watcher, err := fsnotify.NewWatcher()
-		if err != nil {
-			logger.Errorf("Failed to create watcher: %v", err)
-			return false
-		}
-		defer watcher.Close()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return fmt.Errorf("file %s not detected within %v", filePath, timeout)
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("watcher closed")
+			}
 
-		err = watcher.Add(path)
-		if err != nil {
-			logger.Errorf("Failed to add watcher: %v", err)
-			return false
+			if event.Op.Has(fsnotify.Create) && filepath.Clean(event.Name) == filePath {
+				logger.Info("File 'dummy' detected.")
+				return nil
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+			return fmt.Errorf("error occurred in watcher: %w", err)
 		}
+	}
+}
 
-		done := make(chan bool)
+// clearDirectory removes the checkpoints and the dummy file left in directory.
+// They belong to root, hence sudo, and the shell is not involved, hence the
+// glob.
+func clearDirectory(directory string) error {
+	entries, err := filepath.Glob(filepath.Join(directory, "*"))
+	if err != nil {
+		return err
+	}
 
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if event.Op.Has(fsnotify.Create) && filepath.Clean(event.Name) == filePath {
-					logger.Info("File 'dummy' detected.")
-					close(done)
-					return true
-				}
+	if len(entries) == 0 {
+		return nil
+	}
 
-				if !ok {
-					logger.Errorf("Error occurred in watcher: %v", err)
-					return false
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					logger.Errorf("Error occurred in watcher: %v", err)
-					return false
-				}
-			}
+	args := append([]string{"rm", "-rf", "--"}, entries...)
+	if output, err := exec.Command("sudo", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("sudo rm -rf %s/*: %w: %s", directory, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// cleanUpOnCancel removes the dummy pod and service and the restored test pods
+// from every namespace, but only when the context was canceled, e.g. on SIGINT
+// or SIGTERM. It is meant to be deferred by the receiving loops.
+func cleanUpOnCancel(ctx context.Context, clientset *kubernetes.Clientset, logger *log.Logger, namespaces ...string) {
+	if ctx.Err() == nil {
+		return
+	}
+
+	logger.Info("Interrupted, cleaning up")
+
+	cleanUpCtx, cancel := context.WithTimeout(context.Background(), cleanUpTimeout)
+	defer cancel()
+
+	for _, namespace := range namespaces {
+		if err := DeleteDummyPodAndService(cleanUpCtx, clientset, namespace, "dummy-pod", "dummy-service"); err != nil {
+			logger.Errorf("Unable to delete the dummy pod and service in %s: %v", namespace, err)
 		}
+
+		if err := DeletePodsStartingWithTest(cleanUpCtx, clientset, namespace); err != nil {
+			logger.Errorf("Unable to delete the test pods in %s: %v", namespace, err)
+		}
+	}
+}
+
+// manifestTimeout bounds how long the receiver waits for the announced
+// archives to be complete on disk.
+const manifestTimeout = 2 * time.Minute
+
+// phaseResult builds a completed phase.
+func phaseResult(name string, start time.Time, end time.Time, err error) control.Phase {
+	phase := control.Phase{Name: name, Start: start, End: end}
+	if err != nil {
+		phase.Error = err.Error()
+	}
+
+	return phase
+}
+
+// firstRequest waits for the restored pod to answer on FIRST_REQUEST_PORT,
+// port 80 by default.
+func firstRequest(ctx context.Context, clientset *kubernetes.Clientset, podName string, namespace string) error {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if pod.Status.PodIP == "" {
+		return fmt.Errorf("pod %s has no IP", podName)
 	}
+
+	port := os.Getenv("FIRST_REQUEST_PORT")
+	if port == "" {
+		port = "80"
+	}
+
+	return waitForFirstRequest(ctx, "http://"+net.JoinHostPort(pod.Status.PodIP, port)+"/", firstRequestTimeout)
 }
 
-func Receive(logger *log.Logger) {
-	ctx, cancel := context.WithCancel(context.Background())
+// DefaultRestoreConcurrency is how many migrations the receiver restores at
+// once unless configured otherwise.
+const DefaultRestoreConcurrency = 1
+
+// ReceiverOptions configures Receive.
+type ReceiverOptions struct {
+	// WaitTimeout is how long to wait for the next migration.
+	WaitTimeout time.Duration
+	// RestoreConcurrency is how many migrations are restored at once, the
+	// others wait in the queue of the control server.
+	RestoreConcurrency int
+	// RestoreStrategy is used for the migrations whose sender did not choose
+	// one, see control.RestoreSequential and control.RestoreParallel.
+	RestoreStrategy string
+	// TransferListen is the address of the tar-over-TCP transfers, none when
+	// empty. HTTP uploads are always served next to the control channel.
+	TransferListen string
+}
+
+// receiver holds what the restore workers share. The database connection is
+// not safe for concurrent use, so every write goes through record.
+type receiver struct {
+	server     *control.Server
+	clientset  *kubernetes.Clientset
+	reconciler controllers.LiveMigrationReconciler
+	namespace  string
+	concurrent bool
+	logger     *log.Logger
+
+	dbMu sync.Mutex
+	db   *pgx.Conn
+}
+
+func (r *receiver) record(write func(db *pgx.Conn)) {
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+
+	write(r.db)
+}
+
+// Receive restores every migration announced on the control channel, each
+// from its own subdirectory of the checkpoint root, up to
+// options.RestoreConcurrency at a time. The restore only starts once the
+// subdirectory matches the manifest of the announcement and holds the manifest
+// file of the same migration, and its phases, including the time spent in the
+// queue, are reported back to the sender. Every row is stored with the
+// migration ID chosen by the sender. It returns when no migration is announced
+// within options.WaitTimeout, when the context is canceled, after cleaning up,
+// or on the first unrecoverable error, once the running restores are done.
+func Receive(ctx context.Context, logger *log.Logger, options ReceiverOptions) error {
+	if options.RestoreConcurrency < 1 {
+		return fmt.Errorf("restore concurrency must be at least 1, got %d", options.RestoreConcurrency)
+	}
+
+	if !control.ValidRestoreStrategy(options.RestoreStrategy) {
+		return fmt.Errorf("unknown restore strategy %q", options.RestoreStrategy)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	godotenv.Load(".env")
 
 	db, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
 	if err != nil {
-		logger.Errorf("Unable to connect to database: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("unable to connect to database: %w", err)
 	}
-	defer db.Close(ctx)
+	defer db.Close(context.Background())
 
 	// Load Kubernetes config
 	kubeconfigPath := os.Getenv("KUBECONFIG")
@@ -84,31 +241,23 @@ func Receive(logger *log.Logger) {
 
 	kubeconfigPath = os.ExpandEnv(kubeconfigPath)
 	if _, err := os.Stat(kubeconfigPath); os.IsNotExist(err) {
-		logger.Info("Kubeconfig file not found")
-		return
+		return errors.New("kubeconfig file not found")
 	}
 
 	kubeconfig, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
 	if err != nil {
-		logger.Errorf("Error loading kubeconfig")
-		return
+		return fmt.Errorf("error loading kubeconfig: %w", err)
 	}
 
 	// Create Kubernetes API client
 	clientset, err := kubernetes.NewForConfig(kubeconfig)
 	if err != nil {
-		logger.Errorf("Error creating kubernetes client")
-		return
+		return fmt.Errorf("error creating kubernetes client: %w", err)
 	}
 
-	reconciler := controllers.LiveMigrationReconciler{}
 	namespace := os.Getenv("NAMESPACE")
 
-	directory := os.Getenv("CHECKPOINTS_FOLDER")
-	if err != nil {
-		logger.Errorf(err.Error())
-		return
-	}
+	defer cleanUpOnCancel(ctx, clientset, logger, namespace)
 
 	_, err = clientset.CoreV1().Pods(namespace).Get(ctx, "dummy-pod", metav1.GetOptions{})
 	if err == nil {
@@ -116,86 +265,243 @@ func Receive(logger *log.Logger) {
 		_ = utils.WaitForPodDeletion(ctx, "dummy-pod", namespace, clientset)
 	}
 
-	err = dummy.CreateDummyPod(clientset, ctx, namespace)
-	if err != nil {
-		logger.Errorf(err.Error())
-		return
+	if err := dummy.CreateDummyPod(clientset, ctx, namespace); err != nil {
+		return err
 	}
 
-	err = dummy.CreateDummyService(clientset, ctx, namespace)
-	if err != nil {
-		logger.Errorf(err.Error())
-		return
+	if err := dummy.CreateDummyService(clientset, ctx, namespace); err != nil {
+		return err
 	}
 
-	logger.Info("Starting receiver")
-	i := 0
+	// The dummy pod mounts the checkpoint folder, which is never removed as a
+	// whole: each restore only removes its own subdirectory, so the dummy pod
+	// and service are kept for the whole run.
 
-	for {
-		if waitForFile(21000*time.Second, directory) {
-			logger.Info("File detected, restoring pod")
+	listen := os.Getenv("CONTROL_LISTEN")
+	if listen == "" {
+		listen = control.DefaultListen
+	}
 
-			start := time.Now()
+	r := &receiver{
+		server:     control.NewServer(options.RestoreStrategy),
+		clientset:  clientset,
+		reconciler: controllers.LiveMigrationReconciler{},
+		namespace:  namespace,
+		concurrent: options.RestoreConcurrency > 1,
+		logger:     logger,
+		db:         db,
+	}
 
-			pod, err := reconciler.BuildahRestore(ctx, directory, clientset, namespace)
-			if err != nil {
-				logger.Error(err.Error())
-				os.Exit(1)
-			} else {
-				logger.Infof("Pod restored %s", pod.Name)
+	r.server.Handle(transfer.UploadPath, transfer.UploadHandler(CheckpointRoot()))
 
-				utils.WaitForContainerReady(pod.Name, namespace, pod.Spec.Containers[0].Name, clientset)
+	if options.TransferListen != "" {
+		go func() {
+			if err := transfer.ServeTCP(ctx, options.TransferListen, CheckpointRoot()); err != nil {
+				logger.Errorf("Tar-over-TCP transfers stopped: %v", err)
+			}
+		}()
+	}
 
-				elapsed := time.Since(start)
-				end := time.Now()
-				logger.Infof("[MEASURE] Restoring the pod took %d\n", elapsed)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- r.server.ListenAndServe(ctx, listen)
+		cancel()
+	}()
 
-				SaveTimeToDB(ctx, db, len(pod.Spec.Containers), elapsed, "restore", "total_times", "containers", "elapsed")
-				if err != nil {
-					logger.Error(err.Error())
-				}
+	logger.Infof("Starting receiver, control channel on %s, %d concurrent %s restores", listen, options.RestoreConcurrency, options.RestoreStrategy)
 
-				if i%2 == 0 {
-					SaveAbsoluteTimeToDB(ctx, db, len(pod.Spec.Containers), end, "restore", "back_and_forth_times", "containers", "elapsed")
-					if err != nil {
-						logger.Error(err.Error())
-					}
-				}
+	slots := make(chan struct{}, options.RestoreConcurrency)
+	var workers sync.WaitGroup
+	defer workers.Wait()
 
-				i++
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 
-				DeletePodsStartingWithTest(ctx, clientset, pod.Namespace)
+		waitCtx, cancelWait := context.WithTimeout(ctx, options.WaitTimeout)
+		announcement, err := r.server.Next(waitCtx)
+		cancelWait()
+		if err != nil {
+			select {
+			case err := <-serverErr:
+				if err != nil {
+					return fmt.Errorf("control channel stopped: %w", err)
+				}
+			default:
 			}
 
-			if _, err := exec.Command("sudo", "rm", "-rf", directory).Output(); err != nil {
-				logger.Error("Delete checkpoints failed")
-				logger.Error(err.Error())
-				return
+			if ctx.Err() != nil {
+				return ctx.Err()
 			}
+			return fmt.Errorf("no migration announced within %v", options.WaitTimeout)
+		}
 
-			if _, err = exec.Command("sudo", "mkdir", "/tmp/checkpoints/checkpoints/").Output(); err != nil {
-				logger.Error(err.Error())
-				return
-			}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			defer func() { <-slots }()
 
-			_ = DeleteDummyPodAndService(ctx, clientset, namespace, "dummy-pod", "dummy-service")
-			_ = utils.WaitForPodDeletion(ctx, "dummy-pod", namespace, clientset)
+			r.restore(ctx, announcement)
+		}()
+	}
+}
 
-			err = dummy.CreateDummyPod(clientset, ctx, namespace)
-			if err != nil {
-				logger.Errorf(err.Error())
-				return
-			}
+// buildahRestore restores the pod from directory with the given strategy.
+func (r *receiver) buildahRestore(ctx context.Context, strategy string, directory string) (*v1.Pod, error) {
+	if strategy == control.RestoreParallel {
+		return r.reconciler.BuildahRestoreParallelized(ctx, directory, r.clientset, r.namespace)
+	}
 
-			err = dummy.CreateDummyService(clientset, ctx, namespace)
-			if err != nil {
-				logger.Errorf(err.Error())
-				return
-			}
+	return r.reconciler.BuildahRestore(ctx, directory, r.clientset, r.namespace)
+}
+
+// restore verifies and restores a migration, reports its outcome to the sender
+// and removes its subdirectory, unless the migration failed and
+// KEEP_FAILED_CHECKPOINTS is set.
+func (r *receiver) restore(ctx context.Context, announcement control.Announcement) {
+	id := announcement.MigrationID
+	trial := OpenTrial(announcement.Directory)
+	directory := trial.Directory
+	r.logger.Infof("Migration %s announced by pod %s, %s restore from %s", id, announcement.Pod, announcement.RestoreStrategy, directory)
+
+	timings := control.Timings{}
+	for _, phase := range r.server.Phases(id) {
+		if phase.Name == control.PhaseQueue {
+			timings.QueueDelay = phase.Duration()
+			r.logger.Infof("[MEASURE] Migration %s waited %v in the queue\n", id, timings.QueueDelay)
+		}
+	}
+
+	// The subdirectory is only removed once the outcome is stored, so that
+	// it cannot be reused while the migration is still running.
+	defer trial.Close()
 
-		} else {
-			logger.Error("Timeout: File not detected.")
-			os.Exit(1)
+	finish := func(err error) {
+		if err != nil {
+			trial.Fail()
 		}
+
+		// The status, phases included, is dropped a while after Finish.
+		phases := r.server.Phases(id)
+		r.record(func(db *pgx.Conn) {
+			SavePhasesToDB(ctx, db, id, "receiver", phases)
+		})
+		r.server.Finish(id, timings, err)
 	}
+
+	// Compressed archives are waited for as they travel and decompressed
+	// before their checksums are verified.
+	compression, err := transfer.ParseCompression(announcement.Compression)
+	if err != nil {
+		r.logger.Error(err.Error())
+		finish(err)
+		return
+	}
+
+	arriving := announcement.Manifest
+	if compression.Enabled() {
+		arriving = announcement.Compressed
+	}
+
+	r.server.StartPhase(id, control.PhaseVerify)
+	verifyCtx, cancelVerify := context.WithTimeout(ctx, manifestTimeout)
+	err = arriving.WaitFor(verifyCtx, directory, id, 200*time.Millisecond)
+	cancelVerify()
+	r.server.EndPhase(id, control.PhaseVerify, err)
+
+	if err == nil && compression.Enabled() {
+		r.server.StartPhase(id, control.PhaseDecompress)
+		var decompressed transfer.CompressionResult
+		decompressed, err = transfer.DecompressDirectory(directory, compression)
+		timings.Decompression = decompressed.Elapsed
+		r.server.EndPhase(id, control.PhaseDecompress, err)
+		r.logger.Infof("[MEASURE] Decompressing %d bytes with %s took %v\n", decompressed.CompressedBytes, compression, timings.Decompression)
+	}
+
+	if err == nil {
+		r.server.StartPhase(id, control.PhaseChecksum)
+		verificationStart := time.Now()
+		err = announcement.Manifest.VerifyChecksums(directory)
+		timings.Verification = time.Since(verificationStart)
+		r.server.EndPhase(id, control.PhaseChecksum, err)
+		r.logger.Infof("[MEASURE] Verifying the archives took %v\n", timings.Verification)
+	}
+
+	if err != nil {
+		r.logger.Error(err.Error())
+		finish(err)
+		return
+	}
+
+	start := time.Now()
+	timings.RestoreStart = start
+
+	// BuildahRestore builds the images and then creates the pod: the creation
+	// of the pod, seen through a watch, splits the two. With several restores
+	// at once only the announced pod name can be told apart.
+	match := func(name string) bool {
+		return name == announcement.Pod || (!r.concurrent && strings.HasPrefix(name, "test-"))
+	}
+
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	created, err := watchPodCreation(watchCtx, r.clientset, r.namespace, match)
+	if err != nil {
+		r.logger.Errorf("Unable to watch the pods, the image build includes the pod creation: %v", err)
+	}
+
+	pod, err := r.buildahRestore(ctx, announcement.RestoreStrategy, directory)
+	restored := time.Now()
+
+	// The watch event may still be on its way.
+	select {
+	case podCreated := <-created:
+		r.server.RecordPhase(id, control.Phase{Name: control.PhaseImageBuild, Start: start, End: podCreated})
+		r.server.RecordPhase(id, phaseResult(control.PhasePodCreate, podCreated, restored, err))
+	case <-time.After(100 * time.Millisecond):
+		r.server.RecordPhase(id, phaseResult(control.PhaseImageBuild, start, restored, err))
+	}
+	cancelWatch()
+
+	if err != nil {
+		r.logger.Error(err.Error())
+		finish(err)
+		return
+	}
+
+	r.logger.Infof("Pod restored %s", pod.Name)
+
+	r.server.StartPhase(id, control.PhaseContainerReady)
+	err = utils.WaitForContainerReady(pod.Name, r.namespace, pod.Spec.Containers[0].Name, r.clientset)
+	r.server.EndPhase(id, control.PhaseContainerReady, err)
+
+	elapsed := time.Since(start)
+	end := time.Now()
+	r.logger.Infof("[MEASURE] Restoring the pod took %d\n", elapsed)
+
+	if err == nil {
+		r.server.StartPhase(id, control.PhaseFirstRequest)
+		requestErr := firstRequest(ctx, r.clientset, pod.Name, r.namespace)
+		r.server.EndPhase(id, control.PhaseFirstRequest, requestErr)
+		if requestErr != nil {
+			r.logger.Error(requestErr.Error())
+		}
+	}
+
+	timings.RestoreEnd = end
+	timings.RestoreElapsed = elapsed
+	finish(err)
+
+	// A failed restore is recorded by finish, its time would skew the
+	// restore statistics.
+	if err == nil {
+		r.record(func(db *pgx.Conn) {
+			SaveTotalTimeToDB(ctx, db, id, len(pod.Spec.Containers), elapsed, "restore", announcement.RestoreStrategy)
+			SaveMigrationAbsoluteTimeToDB(ctx, db, id, len(pod.Spec.Containers), end, "restore", "back_and_forth_times")
+		})
+	}
+
+	CleanUp(ctx, r.clientset, pod, r.namespace)
 }
@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -71,20 +71,33 @@ func GetRestoreTimeSequential(ctx context.Context, clientset *kubernetes.Clients
 
 	logger.Info("Checkpointing...")
 
+	trial, err := NewTrial(newTrialID("restore-sequential"))
+	if err != nil {
+		CleanUp(ctx, clientset, pod, namespace)
+		logger.Error(err.Error())
+		return
+	}
+	defer trial.Close()
+
 	err = controllers.CheckpointPodPipelined(containers, namespace, pod.Name)
+	if collectErr := trial.Collect(); err == nil {
+		err = collectErr
+	}
 	if err != nil {
+		trial.Fail()
+		CleanUp(ctx, clientset, pod, namespace)
+		logger.Error(err.Error())
 		return
 	}
 
-	path := "/tmp/checkpoints/checkpoints/"
 	// create dummy file
-	_, err = os.Create(path + "dummy")
+	_, err = os.Create(filepath.Join(trial.Directory, "dummy"))
 	if err != nil {
 		logger.Errorf(err.Error())
 		return
 	}
 
-	files, err := CountFilesInFolder(path)
+	files, err := CountFilesInFolder(trial.Directory)
 	if err != nil {
 		logger.Errorf(err.Error())
 		return
@@ -101,14 +114,16 @@ func GetRestoreTimeSequential(ctx context.Context, clientset *kubernetes.Clients
 
 	start := time.Now()
 
-	pod, err = reconciler.BuildahRestore(ctx, "/tmp/checkpoints/checkpoints", clientset, namespace)
+	pod, err = reconciler.BuildahRestore(ctx, trial.Directory, clientset, namespace)
 	if err != nil {
+		trial.Fail()
 		logger.Errorf(err.Error())
 		return
 	}
 
 	err = utils.WaitForContainerReady(pod.Name, namespace, fmt.Sprintf("container-%d", numContainers-1), clientset)
 	if err != nil {
+		trial.Fail()
 		CleanUp(ctx, clientset, pod, namespace)
 		logger.Errorf(err.Error())
 		return
@@ -125,16 +140,6 @@ func GetRestoreTimeSequential(ctx context.Context, clientset *kubernetes.Clients
 		BuildahDeleteImage("localhost/leonardopoggiani/checkpoint-images:container-" + strconv.Itoa(i))
 	}
 
-	if _, err := exec.Command("sudo", "rm", "-rf", "/tmp/checkpoints/checkpoints/").Output(); err != nil {
-		logger.Error(err.Error())
-		return
-	}
-
-	if _, err := exec.Command("sudo", "mkdir", "/tmp/checkpoints/checkpoints/").Output(); err != nil {
-		logger.Error(err.Error())
-		return
-	}
-
 	CleanUp(ctx, clientset, pod, namespace)
 }
 
@@ -191,20 +196,33 @@ func GetRestoreTimeParallelized(ctx context.Context, clientset *kubernetes.Clien
 
 	logger.Infof("Checkpointing %d containers...", len(containers))
 
+	trial, err := NewTrial(newTrialID("restore-parallelized"))
+	if err != nil {
+		CleanUp(ctx, clientset, pod, namespace)
+		logger.Error(err.Error())
+		return
+	}
+	defer trial.Close()
+
 	err = controllers.CheckpointPodPipelined(containers, namespace, pod.Name)
+	if collectErr := trial.Collect(); err == nil {
+		err = collectErr
+	}
 	if err != nil {
+		trial.Fail()
+		CleanUp(ctx, clientset, pod, namespace)
+		logger.Error(err.Error())
 		return
 	}
 
-	path := "/tmp/checkpoints/checkpoints/"
 	// create dummy file
-	_, err = os.Create(path + "dummy")
+	_, err = os.Create(filepath.Join(trial.Directory, "dummy"))
 	if err != nil {
 		logger.Errorf(err.Error())
 		return
 	}
 
-	files, err := CountFilesInFolder(path)
+	files, err := CountFilesInFolder(trial.Directory)
 	if err != nil {
 		logger.Errorf(err.Error())
 		return
@@ -221,14 +239,16 @@ func GetRestoreTimeParallelized(ctx context.Context, clientset *kubernetes.Clien
 
 	start := time.Now()
 
-	pod, err = reconciler.BuildahRestoreParallelized(ctx, "/tmp/checkpoints/checkpoints", clientset, namespace)
+	pod, err = reconciler.BuildahRestoreParallelized(ctx, trial.Directory, clientset, namespace)
 	if err != nil {
+		trial.Fail()
 		logger.Errorf(err.Error())
 		return
 	}
 
 	err = utils.WaitForContainerReady(pod.Name, namespace, fmt.Sprintf("container-%d", numContainers-1), clientset)
 	if err != nil {
+		trial.Fail()
 		CleanUp(ctx, clientset, pod, namespace)
 		logger.Errorf(err.Error())
 		return
@@ -244,15 +264,5 @@ func GetRestoreTimeParallelized(ctx context.Context, clientset *kubernetes.Clien
 		BuildahDeleteImage("localhost/leonardopoggiani/checkpoint-images:container-" + strconv.Itoa(i))
 	}
 
-	if _, err := exec.Command("sudo", "rm", "-rf", "/tmp/checkpoints/checkpoints/").Output(); err != nil {
-		logger.Error(err.Error())
-		return
-	}
-
-	if _, err := exec.Command("sudo", "mkdir", "/tmp/checkpoints/checkpoints/").Output(); err != nil {
-		logger.Error(err.Error())
-		return
-	}
-
 	CleanUp(ctx, clientset, pod, namespace)
 }
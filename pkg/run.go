@@ -0,0 +1,244 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/control"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/transfer"
+	"github.com/withmandala/go-log"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Fingerprint describes the environment a run was executed in, so that results
+// coming from different machines or cluster versions can be told apart.
+type Fingerprint struct {
+	Hostname          string            `json:"hostname"`
+	Kernel            string            `json:"kernel"`
+	OS                string            `json:"os"`
+	Arch              string            `json:"arch"`
+	GoVersion         string            `json:"go_version"`
+	NumCPU            int               `json:"num_cpu"`
+	KubernetesVersion string            `json:"kubernetes_version,omitempty"`
+	Env               map[string]string `json:"env"`
+}
+
+// fingerprintEnv lists the environment variables that influence a run.
+var fingerprintEnv = []string{"NAMESPACE", "NUM_CONTAINERS", "REPETITIONS", "CHECKPOINTS_FOLDER"}
+
+func CollectFingerprint(clientset *kubernetes.Clientset) Fingerprint {
+	hostname, _ := os.Hostname()
+
+	kernel := ""
+	if release, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		kernel = strings.TrimSpace(string(release))
+	}
+
+	fingerprint := Fingerprint{
+		Hostname:  hostname,
+		Kernel:    kernel,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		NumCPU:    runtime.NumCPU(),
+		Env:       map[string]string{},
+	}
+
+	for _, name := range fingerprintEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			fingerprint.Env[name] = value
+		}
+	}
+
+	if clientset != nil {
+		if version, err := clientset.Discovery().ServerVersion(); err == nil {
+			fingerprint.KubernetesVersion = version.GitVersion
+		}
+	}
+
+	return fingerprint
+}
+
+// StartRun registers a new run in the runs table and returns its ID. Every
+// measurement written between StartRun and FinishRun belongs to the run.
+func StartRun(ctx context.Context, conn *pgx.Conn, kind string, fingerprint Fingerprint) (string, error) {
+	id := fmt.Sprintf("%s-%04d", time.Now().Format("20060102-150405"), rand.Intn(10000))
+
+	encoded, err := json.Marshal(fingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = conn.Exec(ctx, "INSERT INTO runs (id, kind, fingerprint) VALUES ($1, $2, $3)", id, kind, encoded)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func FinishRun(ctx context.Context, conn *pgx.Conn, id string) {
+	logger := log.New(os.Stderr).WithColor()
+
+	_, err := conn.Exec(ctx, "UPDATE runs SET finished = CURRENT_TIMESTAMP WHERE id = $1", id)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	logger.Infof("Run %s finished", id)
+}
+
+// SaveFailureToDB records a failed trial. migrationID is empty when the
+// trial failed before a migration was started. Integrity errors, local or
+// reported by the receiver, are stored with their class.
+func SaveFailureToDB(
+	ctx context.Context,
+	conn *pgx.Conn,
+	migrationID string,
+	numContainers int,
+	checkpointType string,
+	phase string,
+	failure error) {
+
+	logger := log.New(os.Stderr).WithColor()
+
+	_, err := conn.Exec(ctx, `INSERT INTO failed_trials (migration_id, containers, checkpoint_type, phase, error_class, error)
+		VALUES (NULLIF($1, ''), $2, $3, $4, NULLIF($5, ''), $6)`,
+		migrationID, numContainers, checkpointType, phase, control.ErrorClass(failure), failure.Error())
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	logger.Infof("Failed trial recorded, phase: %s", phase)
+}
+
+// SaveTotalTimeToDB records a duration of a migration in total_times along
+// with the restore strategy of the receiver, empty when it is not known.
+func SaveTotalTimeToDB(
+	ctx context.Context,
+	conn *pgx.Conn,
+	migrationID string,
+	numContainers int,
+	elapsed time.Duration,
+	checkpointType string,
+	restoreStrategy string) {
+
+	logger := log.New(os.Stderr).WithColor()
+
+	_, err := conn.Exec(ctx, `INSERT INTO total_times (migration_id, containers, elapsed, checkpoint_type, restore_strategy)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))`,
+		migrationID, numContainers, elapsed, checkpointType, restoreStrategy)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// RelabelCheckpointTotalTimes gives the checkpoint type "checkpoint" to the
+// checkpoint times the sender stored in total_times as "restore", like the
+// receiver its restore times. A restore row of the receiver is written along
+// with the back_and_forth_times row of its migration, a sender row is not.
+// Rows without a migration ID cannot be told apart and are left alone.
+func RelabelCheckpointTotalTimes(ctx context.Context, conn *pgx.Conn) {
+	logger := log.New(os.Stderr).WithColor()
+
+	tag, err := conn.Exec(ctx, `UPDATE total_times t SET checkpoint_type = 'checkpoint'
+		WHERE t.checkpoint_type = 'restore' AND t.migration_id IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM back_and_forth_times b WHERE b.migration_id = t.migration_id
+			AND b.timestamp BETWEEN t.timestamp AND t.timestamp + INTERVAL '1 second')`)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	logger.Infof("%d checkpoint times relabeled in total_times", tag.RowsAffected())
+}
+
+// SaveMigrationAbsoluteTimeToDB records a point in time of a migration, as
+// Unix milliseconds like SaveAbsoluteTimeToDB.
+func SaveMigrationAbsoluteTimeToDB(
+	ctx context.Context,
+	conn *pgx.Conn,
+	migrationID string,
+	numContainers int,
+	at time.Time,
+	checkpointType string,
+	tableName string) {
+
+	logger := log.New(os.Stderr).WithColor()
+
+	_, err := conn.Exec(ctx, fmt.Sprintf("INSERT INTO %s (migration_id, containers, elapsed, checkpoint_type) VALUES ($1, $2, $3, $4)", tableName),
+		migrationID, numContainers, at.UnixMilli(), checkpointType)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// SaveMigrationSizeToDB records the size of the checkpoint of a migration in
+// checkpoint_sizes, in MB like SaveSizeToDB.
+func SaveMigrationSizeToDB(ctx context.Context, conn *pgx.Conn, migrationID string, numContainers int, size int64, checkpointType string) {
+	logger := log.New(os.Stderr).WithColor()
+
+	_, err := conn.Exec(ctx, "INSERT INTO checkpoint_sizes (migration_id, containers, size, checkpoint_type) VALUES ($1, $2, $3, $4)",
+		migrationID, numContainers, float64(size)/(1024*1024), checkpointType)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// SaveClockOffsetToDB records the offset of the receiver clock measured before
+// a migration, in nanoseconds like the elapsed times.
+func SaveClockOffsetToDB(ctx context.Context, conn *pgx.Conn, migrationID string, offset control.ClockOffset) {
+	logger := log.New(os.Stderr).WithColor()
+
+	_, err := conn.Exec(ctx, `INSERT INTO clock_offsets (timestamp, migration_id, clock_offset, uncertainty, round_trip, samples)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		offset.Measured, migrationID, float64(offset.Offset), float64(offset.Uncertainty), float64(offset.RoundTrip), offset.Samples)
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// SaveTransferToDB records how the archives of a migration were moved, with
+// the elapsed time in nanoseconds like the other times and the throughput in
+// bytes per second. The emulated link is stored as its profile, with its rate
+// in bytes per second apart, NULL when unlimited.
+func SaveTransferToDB(ctx context.Context, conn *pgx.Conn, migrationID string, result transfer.Result) {
+	logger := log.New(os.Stderr).WithColor()
+
+	var rate float64
+	if result.Link != nil {
+		rate = result.Link.Rate
+	}
+
+	_, err := conn.Exec(ctx, `INSERT INTO transfers (migration_id, transport, link, link_rate, files, bytes, elapsed, throughput)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, $7, $8)`,
+		migrationID, result.Transport, result.Link.String(), rate, result.Files, result.Bytes, result.Elapsed, result.Throughput())
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// SaveCompressionToDB records how the archives of a migration were compressed
+// for the transfer: the sizes before and after, the compression time measured
+// by the sender and the decompression time measured by the receiver, zero when
+// it never finished. Times are in nanoseconds like the other times.
+func SaveCompressionToDB(ctx context.Context, conn *pgx.Conn, migrationID string, result transfer.CompressionResult, decompression time.Duration) {
+	logger := log.New(os.Stderr).WithColor()
+
+	_, err := conn.Exec(ctx, `INSERT INTO compressions (migration_id, codec, level, files, raw_bytes, compressed_bytes, ratio, compression_time, decompression_time)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, 0))`,
+		migrationID, result.Compression.Codec, result.Compression.Level, result.Files, result.RawBytes, result.CompressedBytes,
+		result.Ratio(), result.Elapsed, decompression)
+	if err != nil {
+		logger.Error(err)
+	}
+}
@@ -2,8 +2,9 @@ package pkg
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
 	"time"
@@ -12,12 +13,18 @@ import (
 	"github.com/joho/godotenv"
 	controllers "github.com/leonardopoggiani/live-migration-operator/controllers"
 	types "github.com/leonardopoggiani/live-migration-operator/controllers/types"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/control"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/transfer"
 	"github.com/withmandala/go-log"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// restoreTimeout bounds how long the sender waits for the receiver to report
+// the outcome of a migration.
+const restoreTimeout = 10 * time.Minute
+
 func Sender(logger *log.Logger) {
 	ctx := context.Background()
 	godotenv.Load(".env")
@@ -54,6 +61,54 @@ func Sender(logger *log.Logger) {
 
 	namespace := os.Getenv("NAMESPACE")
 
+	receiverURL := os.Getenv("RECEIVER_URL")
+	if receiverURL == "" {
+		logger.Error("RECEIVER_URL not set, the sender cannot reach the receiver")
+		return
+	}
+	receiver := control.NewClient(receiverURL)
+
+	transport, err := newTransport(clientset, namespace, receiverURL)
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+
+	// LINK emulates a slower network on the transfer, with one profile per
+	// trial in turn so that a run can sweep the bandwidth.
+	links, err := transfer.ParseLinks(os.Getenv("LINK"))
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+
+	transports := []transfer.Transport{transport}
+	if len(links) > 0 {
+		transports = nil
+		for _, link := range links {
+			emulated, err := transfer.Emulate(transport, link)
+			if err != nil {
+				logger.Error(err.Error())
+				return
+			}
+			transports = append(transports, emulated)
+		}
+	}
+
+	// COMPRESSION compresses the archives before the transfer, e.g. gzip:6.
+	compression, err := transfer.ParseCompression(os.Getenv("COMPRESSION"))
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+
+	// RESTORE_STRATEGY overrides the strategy of the receiver.
+	restoreStrategy := os.Getenv("RESTORE_STRATEGY")
+	if restoreStrategy != "" && !control.ValidRestoreStrategy(restoreStrategy) {
+		logger.Errorf("Unknown restore strategy %q", restoreStrategy)
+		return
+	}
+
 	err = DeletePodsStartingWithTest(ctx, clientset, namespace)
 	if err != nil {
 		logger.Error("Error deleting pods starting with test-")
@@ -78,16 +133,53 @@ func Sender(logger *log.Logger) {
 		return
 	}
 
+	runID, err := StartRun(ctx, db, "sender", CollectFingerprint(clientset))
+	if err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	defer FinishRun(ctx, db, runID)
+
+	logger.Infof("Run %s started, archives sent with the %s transport, compression %s", runID, transport.Name(), compression)
+
+	// The checkpoint directory of the current migration, closed on the way out
+	// when a failure ends the run.
+	var trial *Trial
+	defer func() {
+		if trial != nil {
+			trial.Close()
+		}
+	}()
+
 	for j := 0; j <= numRepetitions-1; j++ {
 		time.Sleep(60 * time.Second)
 		logger.Infof("Repetitions %d \n", j)
+		migrationID := fmt.Sprintf("%s-%d", runID, j)
+
+		phases := &phaseLog{}
+		savePhases := func() {
+			SavePhasesToDB(ctx, db, migrationID, "sender", phases.phases)
+		}
+
+		phases.start(control.PhasePodCreation)
 		pod := CreateTestContainers(ctx, numContainers, clientset, reconciler, namespace)
+		if pod == nil {
+			err := errors.New("test pod not created")
+			phases.end(err)
+			savePhases()
+			SaveFailureToDB(ctx, db, migrationID, numContainers, "restore", "create", err)
+			continue
+		}
+		phases.end(nil)
 
 		var containers []types.Container
 
+		phases.start(control.PhaseContainerDiscovery)
 		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
 		if err != nil {
 			logger.Error(err.Error())
+			phases.end(err)
+			savePhases()
 			return
 		}
 
@@ -100,6 +192,8 @@ func Sender(logger *log.Logger) {
 
 				if len(idParts) < 2 {
 					logger.Error("Malformed container ID")
+					phases.end(fmt.Errorf("malformed container ID %s", containerStatus.ContainerID))
+					savePhases()
 					return
 				}
 				containerID := idParts[1]
@@ -111,77 +205,181 @@ func Sender(logger *log.Logger) {
 				containers = append(containers, container)
 			}
 		}
+		phases.end(nil)
+
+		// The restore end is read from the receiver clock, so the offset is
+		// needed to compare it with the start below.
+		offset, err := receiver.MeasureClockOffset(ctx, control.DefaultClockProbes)
+		if err != nil {
+			logger.Errorf("Unable to estimate the clock offset of the receiver: %v", err)
+		} else {
+			logger.Infof("[MEASURE] Receiver clock offset %v ± %v\n", offset.Offset, offset.Uncertainty)
+			SaveClockOffsetToDB(ctx, db, migrationID, offset)
+		}
+
+		trial, err = NewTrial(migrationID)
+		if err != nil {
+			logger.Error(err.Error())
+			savePhases()
+			return
+		}
 
 		logger.Infof("Checkpointing pod %s", pod.Name)
+		phases.start(control.PhaseCheckpoint)
 		start := time.Now()
 
 		err = controllers.CheckpointPodPipelined(containers, namespace, pod.Name)
+		phases.end(err)
 		if err != nil {
 			logger.Error(err.Error())
+			savePhases()
+			SaveFailureToDB(ctx, db, migrationID, numContainers, "restore", "checkpoint", err)
+			trial.Fail()
+			if err := trial.Collect(); err != nil {
+				logger.Error(err.Error())
+			}
 			return
 		} else {
 			logger.Info("Checkpointing completed")
 		}
 
-		elapsed := time.Since(start)
+		checkpointed := time.Now()
+		elapsed := checkpointed.Sub(start)
 		logger.Infof("[MEASURE] Checkpoint the pod took %d\n", elapsed)
 
-		SaveTimeToDB(ctx, db, numContainers, elapsed, "restore", "total_times", "containers", "elapsed")
+		logger.Infof("[MEASURE] Start time %d\n", start.UnixMilli())
+		SaveMigrationAbsoluteTimeToDB(ctx, db, migrationID, numContainers, start, "restore", "start_times")
+
+		phases.start(control.PhaseArchiveHandOff)
+		directory := trial.Directory
+		err = trial.Collect()
 		if err != nil {
-			logger.Error(err.Error())
+			logger.Errorf("Error moving the archives: %v\n", err)
+			phases.end(err)
+			savePhases()
+			SaveFailureToDB(ctx, db, migrationID, numContainers, "restore", "manifest", err)
+			trial.Fail()
+			return
 		}
 
-		logger.Infof("[MEASURE] Start time %d\n", start.UnixMilli())
-		SaveAbsoluteTimeToDB(ctx, db, numContainers, start, "restore", "start_times", "containers", "elapsed")
+		manifest, err := control.BuildManifest(directory)
 		if err != nil {
-			logger.Error(err.Error())
+			logger.Errorf("Error reading directory: %v\n", err)
+			phases.end(err)
+			savePhases()
+			trial.Fail()
+			return
 		}
 
-		directory := os.Getenv("CHECKPOINTS_FOLDER")
-
-		if _, err := exec.Command("sudo", "touch", directory+"/dummy").Output(); err != nil {
-			logger.Error(err.Error())
-			return
-		} else {
-			logger.Info("Dummy file created")
+		var size int64
+		for _, entry := range manifest {
+			logger.Infof("File: %s (%d bytes)\n", entry.Path, entry.Size)
+			size += entry.Size
 		}
+		SaveMigrationSizeToDB(ctx, db, migrationID, numContainers, size, "pipelined")
 
-		files, err := os.ReadDir(directory)
+		err = control.WriteManifestFile(directory, migrationID, manifest)
+		phases.end(err)
 		if err != nil {
-			logger.Errorf("Error reading directory: %v\n", err)
+			logger.Errorf("Error writing the manifest: %v\n", err)
+			savePhases()
+			SaveFailureToDB(ctx, db, migrationID, numContainers, "restore", "manifest", err)
+			trial.Fail()
 			return
 		}
 
-		for _, file := range files {
-			if file.IsDir() {
-				logger.Infof("Directory: %s\n", file.Name())
-			} else {
-				logger.Infof("File: %s\n", file.Name())
+		var compressed transfer.CompressionResult
+		if compression.Enabled() {
+			phases.start(control.PhaseCompress)
+			compressed, err = transfer.CompressDirectory(directory, compression)
+			phases.end(err)
+			if err != nil {
+				logger.Errorf("Error compressing the archives: %v\n", err)
+				savePhases()
+				SaveFailureToDB(ctx, db, migrationID, numContainers, "restore", "compress", err)
+				trial.Fail()
+				return
 			}
+			logger.Infof("[MEASURE] Compressing with %s took %v, %d bytes to %d (ratio %.2f)\n",
+				compression, compressed.Elapsed, compressed.RawBytes, compressed.CompressedBytes, compressed.Ratio())
 		}
 
-		err = reconciler.MigrateCheckpoint(ctx, directory, clientset, namespace)
+		phases.start(control.PhaseTransfer)
+		transferred, err := transports[j%len(transports)].Send(ctx, directory, trial.ID)
+		phases.end(err)
+		savePhases()
 		if err != nil {
 			logger.Error(err.Error())
+			SaveFailureToDB(ctx, db, migrationID, numContainers, "restore", "migrate", err)
+			trial.Fail()
 			return
 		} else {
 			logger.Info("Migration completed")
+			logger.Infof("[MEASURE] Transfer with %s over link %s took %v, %d bytes at %.1f MB/s\n",
+				transferred.Transport, transferred.Link, transferred.Elapsed, transferred.Bytes, transferred.Throughput()/(1024*1024))
+			SaveTransferToDB(ctx, db, migrationID, transferred)
 		}
 
-		if _, err := exec.Command("sudo", "rm", "-rf", directory+"/").Output(); err != nil {
-			logger.Error(err.Error())
-			return
-		} else {
-			logger.Info("Checkpoints folder deleted")
+		announcement := control.Announcement{
+			MigrationID:        migrationID,
+			Directory:          trial.ID,
+			RestoreStrategy:    restoreStrategy,
+			Pod:                pod.Name,
+			Namespace:          namespace,
+			CheckpointType:     "restore",
+			Manifest:           manifest,
+			Compressed:         compressed.Manifest,
+			CheckpointStarted:  start,
+			CheckpointFinished: checkpointed,
+			TransferFinished:   time.Now(),
+		}
+		if compression.Enabled() {
+			announcement.Compression = compression.String()
+		}
+		for _, container := range containers {
+			announcement.Containers = append(announcement.Containers, control.Container{ID: container.ID, Name: container.Name})
 		}
 
-		if _, err = exec.Command("sudo", "mkdir", "/tmp/checkpoints/checkpoints/").Output(); err != nil {
+		ack, err := receiver.Announce(ctx, announcement)
+		if err != nil {
 			logger.Error(err.Error())
+			SaveFailureToDB(ctx, db, migrationID, numContainers, "restore", "announce", err)
+			trial.Fail()
 			return
+		}
+
+		// The checkpoint time is stored once the receiver has told which
+		// restore strategy it is going to use, apart from its restore time.
+		SaveTotalTimeToDB(ctx, db, migrationID, numContainers, elapsed, "checkpoint", ack.RestoreStrategy)
+		logger.Infof("Migration %s announced to the receiver", announcement.MigrationID)
+
+		waitCtx, cancelWait := context.WithTimeout(ctx, restoreTimeout)
+		status, err := receiver.Wait(waitCtx, announcement.MigrationID, 500*time.Millisecond)
+		cancelWait()
+		if err == nil {
+			err = status.Err()
+		}
+
+		// The decompression time stays unknown when the receiver failed
+		// before or while decompressing.
+		if compression.Enabled() {
+			SaveCompressionToDB(ctx, db, migrationID, compressed, status.Timings.Decompression)
+		}
+
+		if err != nil {
+			logger.Errorf("Restore of migration %s failed: %v", announcement.MigrationID, err)
+			SaveFailureToDB(ctx, db, migrationID, numContainers, "restore", "restore", err)
+			trial.Fail()
 		} else {
-			logger.Info("Checkpoints folder created")
+			for _, phase := range status.Phases {
+				logger.Infof("[MEASURE] Receiver phase %s took %v\n", phase.Name, phase.Duration())
+			}
+			logger.Infof("[MEASURE] Receiver restore took %v\n", status.Timings.RestoreElapsed)
 		}
 
+		trial.Close()
+		trial = nil
+
 		DeletePodsStartingWithTest(ctx, clientset, namespace)
 	}
 }
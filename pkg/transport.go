@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	controllers "github.com/leonardopoggiani/live-migration-operator/controllers"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/transfer"
+	"k8s.io/client-go/kubernetes"
+)
+
+// operatorTransport moves the archives with MigrateCheckpoint, which copies
+// the directory to the same path on the receiver whatever the name.
+type operatorTransport struct {
+	reconciler controllers.LiveMigrationReconciler
+	clientset  *kubernetes.Clientset
+	namespace  string
+}
+
+func (t operatorTransport) Name() string {
+	return transfer.Operator
+}
+
+func (t operatorTransport) Send(ctx context.Context, directory string, name string) (transfer.Result, error) {
+	result := transfer.Result{Transport: transfer.Operator}
+
+	// The operator does not tell how much it moved, the directory does.
+	files, size, err := transfer.DirectorySize(directory)
+	if err != nil {
+		return result, err
+	}
+
+	start := time.Now()
+	if err := t.reconciler.MigrateCheckpoint(ctx, directory, t.clientset, t.namespace); err != nil {
+		return result, err
+	}
+
+	result.Files, result.Bytes, result.Elapsed = files, size, time.Since(start)
+	return result, nil
+}
+
+// newTransport returns the transport named in TRANSPORT, the operator by
+// default. TRANSPORT_PATH is the path shared with the receiver of the local
+// copy, TRANSPORT_ADDRESS the address of the receiver for tar over TCP; the
+// HTTP upload goes to receiverURL.
+func newTransport(clientset *kubernetes.Clientset, namespace string, receiverURL string) (transfer.Transport, error) {
+	switch name := os.Getenv("TRANSPORT"); name {
+	case "", transfer.Operator:
+		return operatorTransport{clientset: clientset, namespace: namespace}, nil
+	case transfer.Local:
+		root := os.Getenv("TRANSPORT_PATH")
+		if root == "" {
+			return nil, fmt.Errorf("TRANSPORT_PATH not set, the %s transport has nowhere to copy to", name)
+		}
+		return transfer.LocalCopy{Root: root}, nil
+	case transfer.HTTP:
+		return transfer.NewHTTPUpload(receiverURL), nil
+	case transfer.TCP:
+		address := os.Getenv("TRANSPORT_ADDRESS")
+		if address == "" {
+			return nil, fmt.Errorf("TRANSPORT_ADDRESS not set, the %s transport cannot reach the receiver", name)
+		}
+		return transfer.TarTCP{Address: address}, nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q", name)
+	}
+}
@@ -140,6 +140,17 @@ func CreateTable(ctx context.Context, conn *pgx.Conn, tableName string, columns
 	fmt.Printf("Table %s created or already exists.\n", tableName)
 }
 
+// AddColumn adds column to an existing table, so that databases created
+// before the column was introduced keep working after init.
+func AddColumn(ctx context.Context, conn *pgx.Conn, tableName string, column string) {
+	logger := log.New(os.Stderr).WithColor()
+
+	_, err := conn.Exec(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s", tableName, column))
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
 func SaveSizeToDB(
 	ctx context.Context,
 	conn *pgx.Conn,
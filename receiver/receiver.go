@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 
+	"github.com/leonardopoggiani/lmo-performance-evaluation/control"
 	"github.com/leonardopoggiani/lmo-performance-evaluation/pkg"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/transfer"
 	"github.com/withmandala/go-log"
 )
 
@@ -12,7 +18,19 @@ func main() {
 	logger := log.New(os.Stderr).WithColor()
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
 	logger.Info("Receiver program started, waiting for migration request")
 
-	pkg.Receive(logger)
+	err := pkg.Receive(ctx, logger, pkg.ReceiverOptions{
+		WaitTimeout:        pkg.DefaultWaitTimeout,
+		RestoreConcurrency: pkg.DefaultRestoreConcurrency,
+		RestoreStrategy:    control.RestoreSequential,
+		TransferListen:     transfer.DefaultListen,
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Error(err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,110 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CompressionSummary describes the compressions made with a codec and level in
+// the report window, with the speeds in MB/s of raw archive. Compression pays
+// off on links slower than BreakEven, where the time saved moving fewer bytes
+// exceeds the time spent compressing and decompressing them. BreakEven only
+// counts the migrations whose decompression time is known, zero when none is.
+type CompressionSummary struct {
+	Compression     string
+	N               int
+	MeanRatio       float64
+	MeanMegabytes   float64
+	CompressSpeed   float64
+	DecompressSpeed float64
+	BreakEven       float64
+}
+
+// LoadCompressions summarises the compressions of the filter window per codec
+// and level, in the order they were first used.
+func LoadCompressions(ctx context.Context, conn *pgx.Conn, filter Filter) ([]CompressionSummary, error) {
+	where, args := whereClause(filter)
+	query := "SELECT codec, level, raw_bytes, compressed_bytes, ratio, compression_time, decompression_time FROM compressions" +
+		where + " ORDER BY timestamp"
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type totals struct {
+		raw, compressSeconds float64
+		// Over the migrations whose decompression time is known.
+		decompressed, saved, roundTripSeconds, decompressSeconds float64
+	}
+
+	var summaries []CompressionSummary
+	index := map[string]int{}
+	sums := map[string]*totals{}
+
+	for rows.Next() {
+		var codec string
+		var level int
+		var raw, compressed int64
+		var ratio, compression float64
+		var decompression *float64
+
+		if err := rows.Scan(&codec, &level, &raw, &compressed, &ratio, &compression, &decompression); err != nil {
+			return nil, err
+		}
+
+		name := fmt.Sprintf("%s:%d", codec, level)
+		position, ok := index[name]
+		if !ok {
+			summaries = append(summaries, CompressionSummary{Compression: name})
+			position = len(summaries) - 1
+			index[name] = position
+			sums[name] = &totals{}
+		}
+
+		megabytes := float64(raw) / (1024 * 1024)
+
+		summary := &summaries[position]
+		summary.N++
+		summary.MeanRatio += ratio
+		summary.MeanMegabytes += megabytes
+
+		sum := sums[name]
+		sum.raw += megabytes
+		sum.compressSeconds += compression / float64(time.Second)
+
+		if decompression != nil {
+			sum.decompressed += megabytes
+			sum.saved += float64(raw-compressed) / (1024 * 1024)
+			sum.decompressSeconds += *decompression / float64(time.Second)
+			sum.roundTripSeconds += (compression + *decompression) / float64(time.Second)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range summaries {
+		summary := &summaries[i]
+		sum := sums[summary.Compression]
+		n := float64(summary.N)
+		summary.MeanRatio /= n
+		summary.MeanMegabytes /= n
+
+		if sum.compressSeconds > 0 {
+			summary.CompressSpeed = sum.raw / sum.compressSeconds
+		}
+
+		if sum.decompressSeconds > 0 {
+			summary.DecompressSpeed = sum.decompressed / sum.decompressSeconds
+			summary.BreakEven = sum.saved / sum.roundTripSeconds
+		}
+	}
+
+	return summaries, nil
+}
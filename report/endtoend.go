@@ -0,0 +1,111 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/latency"
+)
+
+// EndToEndTable names the scenario of the end-to-end migration times, from the
+// checkpoint start on the sender to the restore end on the receiver.
+const EndToEndTable = "end_to_end_times"
+
+// Strategies of the end-to-end scenario. Migrations without a clock offset
+// measurement are kept apart, since the skew between the hosts is part of
+// their times.
+const (
+	StrategyCorrected   = "clock corrected"
+	StrategyUncorrected = "uncorrected"
+)
+
+// ClockSummary describes the receiver clock offsets measured in the report
+// window. Values are in milliseconds.
+type ClockSummary struct {
+	N              int
+	MinOffset      float64
+	MaxOffset      float64
+	MaxUncertainty float64
+}
+
+// LoadEndToEnd computes the end-to-end time of every migration in the filter
+// window, with the restore end moved to the sender clock when possible, and
+// groups them by container count.
+func LoadEndToEnd(ctx context.Context, conn *pgx.Conn, filter Filter) (*Scenario, error) {
+	since, until := filter.Since, filter.Until
+	if until.IsZero() {
+		until = time.Now()
+	}
+
+	windows, err := latency.LoadMigrationWindows(ctx, conn, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	scenario := &Scenario{
+		Table: EndToEndTable,
+		Query: "start_times JOIN back_and_forth_times USING (migration_id), restore end corrected by clock_offsets",
+	}
+	index := map[string]int{}
+
+	for _, window := range windows {
+		if window.End.IsZero() {
+			continue
+		}
+
+		strategy := StrategyUncorrected
+		if window.Corrected {
+			strategy = StrategyCorrected
+		}
+
+		key := fmt.Sprintf("%s/%d", strategy, window.Containers)
+		position, ok := index[key]
+		if !ok {
+			scenario.Cells = append(scenario.Cells, Cell{Strategy: strategy, Containers: window.Containers})
+			position = len(scenario.Cells) - 1
+			index[key] = position
+		}
+
+		scenario.Cells[position].Values = append(scenario.Cells[position].Values, float64(window.Duration())/float64(time.Millisecond))
+	}
+
+	for i := range scenario.Cells {
+		scenario.Cells[i].Summary = Summarize(scenario.Cells[i].Values, 0.95)
+	}
+
+	return scenario, nil
+}
+
+// LoadClockSummary summarises the clock offsets measured in the filter window.
+// It returns nil when none was measured.
+func LoadClockSummary(ctx context.Context, conn *pgx.Conn, filter Filter) (*ClockSummary, error) {
+	until := filter.Until
+	if until.IsZero() {
+		until = time.Now()
+	}
+
+	offsets, err := latency.LoadClockOffsets(ctx, conn, filter.Since, until)
+	if err != nil || len(offsets) == 0 {
+		return nil, err
+	}
+
+	millis := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+
+	summary := &ClockSummary{
+		N:         len(offsets),
+		MinOffset: millis(offsets[0].Offset),
+		MaxOffset: millis(offsets[0].Offset),
+	}
+
+	for _, offset := range offsets {
+		summary.MinOffset = min(summary.MinOffset, millis(offset.Offset))
+		summary.MaxOffset = max(summary.MaxOffset, millis(offset.Offset))
+		summary.MaxUncertainty = max(summary.MaxUncertainty, millis(offset.Uncertainty))
+	}
+
+	return summary, nil
+}
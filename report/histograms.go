@@ -0,0 +1,84 @@
+package report
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/latency"
+)
+
+// Quantiles reported for the merged latency histograms.
+var Quantiles = []float64{0.5, 0.9, 0.99, 0.999, 0.9999}
+
+// LatencyHistogram merges every histogram of a target and phase in the report
+// window. Values are in microseconds.
+type LatencyHistogram struct {
+	Target    string
+	Phase     string
+	Buckets   int
+	Failures  int64
+	Histogram *latency.Histogram
+}
+
+// QuantileMillis returns the value at quantile q in milliseconds.
+func (h LatencyHistogram) QuantileMillis(q float64) float64 {
+	return float64(h.Histogram.ValueAtQuantile(q)) / 1000
+}
+
+func (h LatencyHistogram) MeanMillis() float64 {
+	return h.Histogram.Mean() / 1000
+}
+
+func (h LatencyHistogram) MaxMillis() float64 {
+	return float64(h.Histogram.Max()) / 1000
+}
+
+// LoadHistograms reads the histograms stored by the latency command in the
+// filter window and merges them per target and phase, so that high quantiles
+// are computed over every request rather than averaged across buckets.
+func LoadHistograms(ctx context.Context, conn *pgx.Conn, filter Filter) ([]LatencyHistogram, error) {
+	where, args := whereClause(filter)
+	query := "SELECT target, phase, failures, histogram FROM latency_histograms" + where + " ORDER BY target, phase, timestamp"
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var histograms []LatencyHistogram
+	index := map[string]int{}
+
+	for rows.Next() {
+		var target, phase string
+		var failures int64
+		var encoded []byte
+
+		if err := rows.Scan(&target, &phase, &failures, &encoded); err != nil {
+			return nil, err
+		}
+
+		histogram, err := latency.DecodeHistogram(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("histogram of %s (%s): %w", target, phase, err)
+		}
+
+		key := target + "/" + phase
+		position, ok := index[key]
+		if !ok {
+			histograms = append(histograms, LatencyHistogram{Target: target, Phase: phase, Histogram: latency.NewLatencyHistogram()})
+			position = len(histograms) - 1
+			index[key] = position
+		}
+
+		merged := &histograms[position]
+		if err := merged.Histogram.Merge(histogram); err != nil {
+			return nil, err
+		}
+		merged.Buckets++
+		merged.Failures += failures
+	}
+
+	return histograms, rows.Err()
+}
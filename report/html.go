@@ -0,0 +1,358 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+)
+
+// palette is used to colour the strategies in the charts.
+var palette = []string{"#2187bb", "#f44336", "#4caf50", "#ff9800", "#9c27b0", "#607d8b"}
+
+// phasePalette colours the phases of the breakdown chart, one colour each.
+var phasePalette = []string{"#2187bb", "#80bfe0", "#f44336", "#f9a19a", "#4caf50", "#ff9800", "#ffc870", "#9c27b0", "#c89ad3", "#607d8b"}
+
+const htmlTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Performance report{{if .Run}} {{.Run.ID}}{{end}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 1100px; color: #222; }
+h1 { border-bottom: 2px solid #2187bb; padding-bottom: .3em; }
+h2 { margin-top: 2em; color: #2187bb; }
+table { border-collapse: collapse; margin: 1em 0; font-size: 14px; }
+th, td { border: 1px solid #ddd; padding: 4px 10px; text-align: right; }
+th { background: #f4f6f8; }
+td.text, th.text { text-align: left; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 4px 16px; }
+dt { font-weight: bold; }
+dd { margin: 0; font-family: monospace; }
+code { font-size: 12px; color: #555; }
+svg text { font-size: 12px; fill: #333; }
+.empty { color: #777; font-style: italic; }
+.note { color: #555; }
+</style>
+</head>
+<body>
+<h1>Performance report</h1>
+
+<h2>Run</h2>
+<dl>
+{{- if .Run}}
+<dt>Run ID</dt><dd>{{.Run.ID}}</dd>
+<dt>Kind</dt><dd>{{.Run.Kind}}</dd>
+<dt>Started</dt><dd>{{.Run.Started.Format "2006-01-02 15:04:05 MST"}}</dd>
+<dt>Finished</dt><dd>{{if .Run.Finished}}{{.Run.Finished.Format "2006-01-02 15:04:05 MST"}}{{else}}not finished{{end}}</dd>
+{{- else}}
+<dt>Run ID</dt><dd>all runs</dd>
+{{- end}}
+<dt>Generated</dt><dd>{{.Generated.Format "2006-01-02 15:04:05 MST"}}</dd>
+</dl>
+
+<h2>Environment</h2>
+<dl>
+<dt>Hostname</dt><dd>{{.Fingerprint.Hostname}}</dd>
+<dt>Kernel</dt><dd>{{.Fingerprint.Kernel}}</dd>
+<dt>Platform</dt><dd>{{.Fingerprint.OS}}/{{.Fingerprint.Arch}}, {{.Fingerprint.NumCPU}} CPUs</dd>
+<dt>Go</dt><dd>{{.Fingerprint.GoVersion}}</dd>
+{{- if .Fingerprint.KubernetesVersion}}
+<dt>Kubernetes</dt><dd>{{.Fingerprint.KubernetesVersion}}</dd>
+{{- end}}
+{{- range $name, $value := .Fingerprint.Env}}
+<dt>{{$name}}</dt><dd>{{$value}}</dd>
+{{- end}}
+</dl>
+
+{{range .Scenarios}}
+<h2>{{.Table}}</h2>
+<code>{{.Query}}</code>
+{{- if .Note}}
+<p class="note">{{.Note}}</p>
+{{- end}}
+<table>
+<tr><th class="text">Strategy</th><th>Containers</th><th>N</th><th>Mean (ms)</th><th>Std dev</th><th>Median</th><th>P95</th><th>Min</th><th>Max</th><th>95% CI</th></tr>
+{{- range .Cells}}
+<tr><td class="text">{{.Strategy}}</td><td>{{.Containers}}</td><td>{{.Summary.N}}</td><td>{{printf "%.2f" .Summary.Mean}}</td><td>{{printf "%.2f" .Summary.StdDev}}</td><td>{{printf "%.2f" .Summary.Median}}</td><td>{{printf "%.2f" .Summary.P95}}</td><td>{{printf "%.2f" .Summary.Min}}</td><td>{{printf "%.2f" .Summary.Max}}</td><td>[{{printf "%.2f" .Summary.CILow}}, {{printf "%.2f" .Summary.CIHigh}}]</td></tr>
+{{- end}}
+</table>
+{{chart .}}
+{{else}}
+<p class="empty">No measurements found.</p>
+{{end}}
+
+{{if .Histograms}}
+<h2>Latency histograms</h2>
+<table>
+<tr><th class="text">Target</th><th class="text">Phase</th><th>N</th><th>Failures</th><th>Mean (ms)</th>{{range quantiles}}<th>P{{percent .}}</th>{{end}}<th>Max</th></tr>
+{{- range .Histograms}}
+{{- $h := .}}
+<tr><td class="text">{{.Target}}</td><td class="text">{{.Phase}}</td><td>{{.Histogram.TotalCount}}</td><td>{{.Failures}}</td><td>{{printf "%.3f" .MeanMillis}}</td>{{range quantiles}}<td>{{printf "%.3f" ($h.QuantileMillis .)}}</td>{{end}}<td>{{printf "%.3f" .MaxMillis}}</td></tr>
+{{- end}}
+</table>
+{{end}}
+
+{{if .Phases}}
+<h2>Migration phases</h2>
+<p>Time spent in every phase of each migration, measured by the sender up to the transfer and by the receiver afterwards.</p>
+{{phaseChart .Phases}}
+<table>
+<tr><th class="text">Migration</th>{{range phaseNames .Phases}}<th>{{.}} (ms)</th>{{end}}<th>Total</th></tr>
+{{- $phases := .Phases}}
+{{- range .Phases}}
+{{- $b := .}}
+<tr><td class="text">{{.MigrationID}}{{if .Failed}} (failed){{end}}</td>{{range phaseNames $phases}}<td>{{printf "%.1f" ($b.Millis .)}}</td>{{end}}<td>{{printf "%.1f" .TotalMillis}}</td></tr>
+{{- end}}
+<tr><th class="text">Mean</th>{{range phaseNames $phases}}<th>{{printf "%.1f" (meanPhase $phases .)}}</th>{{end}}<th></th></tr>
+</table>
+{{end}}
+
+{{if .Transfers}}
+<h2>Transfers</h2>
+<p>How the archives were moved to the receiver, over which emulated link, and the share of the migration time, the sum of its phases, spent moving them.</p>
+<table>
+<tr><th class="text">Transport</th><th class="text">Link</th><th>N</th><th>Mean (ms)</th><th>Mean (MB)</th><th>Mean (MB/s)</th><th>Share of migration</th></tr>
+{{- range .Transfers}}
+<tr><td class="text">{{.Transport}}</td><td class="text">{{.Link}}</td><td>{{.N}}</td><td>{{printf "%.1f" .MeanMillis}}</td><td>{{printf "%.2f" .MeanMegabytes}}</td><td>{{printf "%.2f" .MeanThroughput}}</td><td>{{printf "%.1f%%" .SharePercent}}</td></tr>
+{{- end}}
+</table>
+{{end}}
+
+{{if .Compression}}
+<h2>Compression</h2>
+<p>Compression of the archives before the transfer, with speeds in MB of raw archive per second. Compressing pays off on links slower than the last column.</p>
+<table>
+<tr><th class="text">Codec</th><th>N</th><th>Mean ratio</th><th>Mean raw (MB)</th><th>Compress (MB/s)</th><th>Decompress (MB/s)</th><th>Pays off below (MB/s)</th></tr>
+{{- range .Compression}}
+<tr><td class="text">{{.Compression}}</td><td>{{.N}}</td><td>{{printf "%.2f" .MeanRatio}}</td><td>{{printf "%.2f" .MeanMegabytes}}</td><td>{{printf "%.1f" .CompressSpeed}}</td><td>{{printf "%.1f" .DecompressSpeed}}</td><td>{{printf "%.1f" .BreakEven}}</td></tr>
+{{- end}}
+</table>
+{{end}}
+
+{{if .Clock}}
+<h2>Clock offsets</h2>
+<p>Offset of the receiver clock with respect to the sender clock, used to correct the end_to_end_times scenario.</p>
+<table>
+<tr><th>N</th><th>Min offset (ms)</th><th>Max offset (ms)</th><th>Max uncertainty (ms)</th></tr>
+<tr><td>{{.Clock.N}}</td><td>{{printf "%.3f" .Clock.MinOffset}}</td><td>{{printf "%.3f" .Clock.MaxOffset}}</td><td>{{printf "%.3f" .Clock.MaxUncertainty}}</td></tr>
+</table>
+{{end}}
+
+<h2>Failed trials</h2>
+{{if .Failures}}
+<table>
+<tr><th class="text">Timestamp</th><th class="text">Migration</th><th>Containers</th><th class="text">Strategy</th><th class="text">Phase</th><th class="text">Class</th><th class="text">Error</th></tr>
+{{- range .Failures}}
+<tr><td class="text">{{.Timestamp.Format "2006-01-02 15:04:05"}}</td><td class="text">{{.MigrationID}}</td><td>{{.Containers}}</td><td class="text">{{.Strategy}}</td><td class="text">{{.Phase}}</td><td class="text">{{.ErrorClass}}</td><td class="text">{{.Error}}</td></tr>
+{{- end}}
+</table>
+{{else}}
+<p class="empty">No failed trials.</p>
+{{end}}
+</body>
+</html>
+`
+
+// WriteHTML renders the report as a single self-contained HTML page, with the
+// CSS embedded and the charts drawn as inline SVG.
+func WriteHTML(w io.Writer, report *Report) error {
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"chart":      chart,
+		"quantiles":  func() []float64 { return Quantiles },
+		"percent":    func(q float64) string { return fmt.Sprint(q * 100) },
+		"phaseChart": phaseChart,
+		"phaseNames": PhaseNames,
+		"meanPhase":  MeanPhaseMillis,
+	}).Parse(htmlTemplate)
+	if err != nil {
+		return err
+	}
+
+	return tmpl.Execute(w, report)
+}
+
+// chart draws the mean of every cell of the scenario as a bar, grouped by
+// container count, with the confidence interval as a whisker.
+func chart(scenario Scenario) template.HTML {
+	const (
+		width       = 900
+		height      = 320
+		marginLeft  = 70
+		marginRight = 150
+		marginTop   = 20
+		marginBot   = 40
+		ticks       = 5
+	)
+
+	var strategies []string
+	var containers []int
+	seenStrategy := map[string]bool{}
+	seenContainers := map[int]bool{}
+	maxValue := 0.0
+
+	for _, cell := range scenario.Cells {
+		if !seenStrategy[cell.Strategy] {
+			seenStrategy[cell.Strategy] = true
+			strategies = append(strategies, cell.Strategy)
+		}
+		if !seenContainers[cell.Containers] {
+			seenContainers[cell.Containers] = true
+			containers = append(containers, cell.Containers)
+		}
+		if cell.Summary.CIHigh > maxValue {
+			maxValue = cell.Summary.CIHigh
+		}
+	}
+
+	sort.Ints(containers)
+	if maxValue <= 0 {
+		maxValue = 1
+	}
+	maxValue *= 1.1
+
+	plotWidth := float64(width - marginLeft - marginRight)
+	plotHeight := float64(height - marginTop - marginBot)
+	groupWidth := plotWidth / float64(len(containers))
+	barWidth := groupWidth * 0.8 / float64(len(strategies))
+
+	y := func(value float64) float64 {
+		return marginTop + plotHeight - value/maxValue*plotHeight
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, width, height, width, height)
+
+	for i := 0; i <= ticks; i++ {
+		value := maxValue * float64(i) / ticks
+		fmt.Fprintf(&b, `<line x1="%d" x2="%.1f" y1="%.1f" y2="%.1f" stroke="#eee"/>`, marginLeft, marginLeft+plotWidth, y(value), y(value))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end">%.1f</text>`, marginLeft-6, y(value)+4, value)
+	}
+	fmt.Fprintf(&b, `<text x="14" y="%.1f" transform="rotate(-90 14 %.1f)" text-anchor="middle">ms</text>`, marginTop+plotHeight/2, marginTop+plotHeight/2)
+
+	for g, count := range containers {
+		groupX := marginLeft + float64(g)*groupWidth
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%d containers</text>`, groupX+groupWidth/2, height-marginBot+18, count)
+
+		for s, strategy := range strategies {
+			for _, cell := range scenario.Cells {
+				if cell.Strategy != strategy || cell.Containers != count {
+					continue
+				}
+
+				x := groupX + groupWidth*0.1 + float64(s)*barWidth
+				center := x + barWidth/2
+				color := palette[s%len(palette)]
+
+				fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s, %d containers: %.2f ms</title></rect>`,
+					x, y(cell.Summary.Mean), barWidth*0.9, y(0)-y(cell.Summary.Mean), color, html.EscapeString(strategy), count, cell.Summary.Mean)
+				fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%.1f" y2="%.1f" stroke="#222"/>`, center, center, y(cell.Summary.CILow), y(cell.Summary.CIHigh))
+				fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%.1f" y2="%.1f" stroke="#222"/>`, center-4, center+4, y(cell.Summary.CIHigh), y(cell.Summary.CIHigh))
+				fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%.1f" y2="%.1f" stroke="#222"/>`, center-4, center+4, y(cell.Summary.CILow), y(cell.Summary.CILow))
+			}
+		}
+	}
+
+	fmt.Fprintf(&b, `<line x1="%d" x2="%.1f" y1="%.1f" y2="%.1f" stroke="#333"/>`, marginLeft, marginLeft+plotWidth, y(0), y(0))
+
+	for s, strategy := range strategies {
+		legendY := marginTop + 10 + s*20
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="12" height="12" fill="%s"/>`, width-marginRight+20, legendY-10, palette[s%len(palette)])
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, width-marginRight+38, legendY, html.EscapeString(strategy))
+	}
+
+	b.WriteString(`</svg>`)
+
+	return template.HTML(b.String())
+}
+
+// phaseChart draws one horizontal bar per migration, split into its phases.
+func phaseChart(breakdowns []PhaseBreakdown) template.HTML {
+	const (
+		width       = 900
+		rowHeight   = 22
+		marginLeft  = 160
+		marginRight = 170
+		marginTop   = 10
+		marginBot   = 30
+		ticks       = 5
+	)
+
+	names := PhaseNames(breakdowns)
+	colors := map[string]string{}
+	for i, name := range names {
+		colors[name] = phasePalette[i%len(phasePalette)]
+	}
+
+	maxValue := 0.0
+	for _, breakdown := range breakdowns {
+		if total := breakdown.TotalMillis(); total > maxValue {
+			maxValue = total
+		}
+	}
+	if maxValue <= 0 {
+		maxValue = 1
+	}
+	maxValue *= 1.05
+
+	height := marginTop + rowHeight*len(breakdowns) + marginBot
+	if legend := marginTop + 20*len(names) + marginBot; legend > height {
+		height = legend
+	}
+
+	plotWidth := float64(width - marginLeft - marginRight)
+	plotBottom := marginTop + rowHeight*len(breakdowns)
+
+	x := func(value float64) float64 {
+		return marginLeft + value/maxValue*plotWidth
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, width, height, width, height)
+
+	for i := 0; i <= ticks; i++ {
+		value := maxValue * float64(i) / ticks
+		fmt.Fprintf(&b, `<line x1="%.1f" x2="%.1f" y1="%d" y2="%d" stroke="#eee"/>`, x(value), x(value), marginTop, plotBottom)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%.0f ms</text>`, x(value), plotBottom+18, value)
+	}
+
+	for row, breakdown := range breakdowns {
+		y := marginTop + row*rowHeight
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, marginLeft-6, y+rowHeight/2+4, html.EscapeString(breakdown.MigrationID))
+
+		offset := 0.0
+		for _, phase := range breakdown.Phases {
+			stroke := ""
+			if phase.Error != "" {
+				stroke = ` stroke="#222" stroke-dasharray="3 2"`
+			}
+
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s"%s><title>%s (%s): %.1f ms%s</title></rect>`,
+				x(offset), y+2, x(offset+phase.Millis)-x(offset), rowHeight-4, colors[phase.Name], stroke,
+				html.EscapeString(phase.Name), phase.Host, phase.Millis, html.EscapeString(errorSuffix(phase.Error)))
+			offset += phase.Millis
+		}
+	}
+
+	fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="%d" y2="%d" stroke="#333"/>`, marginLeft, marginLeft, marginTop, plotBottom)
+
+	for i, name := range names {
+		legendY := marginTop + 10 + i*20
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="12" height="12" fill="%s"/>`, width-marginRight+20, legendY-10, colors[name])
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, width-marginRight+38, legendY, html.EscapeString(name))
+	}
+
+	b.WriteString(`</svg>`)
+
+	return template.HTML(b.String())
+}
+
+func errorSuffix(err string) string {
+	if err == "" {
+		return ""
+	}
+
+	return ", failed: " + err
+}
@@ -0,0 +1,173 @@
+package report
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/control"
+)
+
+// PhaseSpan is a phase of a migration as measured by host, sender or receiver.
+type PhaseSpan struct {
+	Name   string
+	Host   string
+	Start  time.Time
+	Millis float64
+	Error  string
+}
+
+// PhaseBreakdown holds the phases of a migration in the order they run.
+type PhaseBreakdown struct {
+	MigrationID string
+	Started     time.Time
+	Phases      []PhaseSpan
+}
+
+// Millis returns the duration of the named phase, zero if it was not
+// recorded. A phase run more than once is summed.
+func (b PhaseBreakdown) Millis(name string) float64 {
+	total := 0.0
+	for _, phase := range b.Phases {
+		if phase.Name == name {
+			total += phase.Millis
+		}
+	}
+
+	return total
+}
+
+// TotalMillis sums every phase. Gaps between phases, e.g. the announcement,
+// are not included.
+func (b PhaseBreakdown) TotalMillis() float64 {
+	total := 0.0
+	for _, phase := range b.Phases {
+		total += phase.Millis
+	}
+
+	return total
+}
+
+// Failed reports whether a phase ended with an error.
+func (b PhaseBreakdown) Failed() bool {
+	for _, phase := range b.Phases {
+		if phase.Error != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// phaseOrder ranks the known phases first, in the order they run.
+func phaseOrder(name string) int {
+	for i, phase := range control.Phases {
+		if phase == name {
+			return i
+		}
+	}
+
+	return len(control.Phases)
+}
+
+// LoadPhaseBreakdowns reads the phases recorded in migration_phases in the
+// filter window, grouped per migration in start order. Unfinished phases are
+// skipped.
+func LoadPhaseBreakdowns(ctx context.Context, conn *pgx.Conn, filter Filter) ([]PhaseBreakdown, error) {
+	where, args := whereClause(filter)
+	// The sender rows come first, so that a migration starts with its first
+	// sender phase.
+	query := "SELECT migration_id, host, seq, phase, started, finished, COALESCE(error, '') FROM migration_phases" + where +
+		" ORDER BY migration_id, host DESC, seq"
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var breakdowns []PhaseBreakdown
+	index := map[string]int{}
+
+	for rows.Next() {
+		var id string
+		var seq int
+		var finished *time.Time
+		span := PhaseSpan{}
+
+		if err := rows.Scan(&id, &span.Host, &seq, &span.Name, &span.Start, &finished, &span.Error); err != nil {
+			return nil, err
+		}
+
+		if finished == nil {
+			continue
+		}
+		span.Millis = float64(finished.Sub(span.Start)) / float64(time.Millisecond)
+
+		position, ok := index[id]
+		if !ok {
+			breakdowns = append(breakdowns, PhaseBreakdown{MigrationID: id, Started: span.Start})
+			position = len(breakdowns) - 1
+			index[id] = position
+		}
+
+		breakdowns[position].Phases = append(breakdowns[position].Phases, span)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, breakdown := range breakdowns {
+		sort.SliceStable(breakdown.Phases, func(i, j int) bool {
+			return phaseOrder(breakdown.Phases[i].Name) < phaseOrder(breakdown.Phases[j].Name)
+		})
+	}
+
+	sort.SliceStable(breakdowns, func(i, j int) bool { return breakdowns[i].Started.Before(breakdowns[j].Started) })
+
+	return breakdowns, nil
+}
+
+// PhaseNames lists the phases found in breakdowns, in the order they run.
+func PhaseNames(breakdowns []PhaseBreakdown) []string {
+	seen := map[string]bool{}
+	var names []string
+
+	for _, breakdown := range breakdowns {
+		for _, phase := range breakdown.Phases {
+			if !seen[phase.Name] {
+				seen[phase.Name] = true
+				names = append(names, phase.Name)
+			}
+		}
+	}
+
+	sort.SliceStable(names, func(i, j int) bool { return phaseOrder(names[i]) < phaseOrder(names[j]) })
+
+	return names
+}
+
+// MeanPhaseMillis averages the duration of the named phase over the
+// migrations that recorded it.
+func MeanPhaseMillis(breakdowns []PhaseBreakdown, name string) float64 {
+	sum := 0.0
+	count := 0
+
+	for _, breakdown := range breakdowns {
+		for _, phase := range breakdown.Phases {
+			if phase.Name == name {
+				sum += breakdown.Millis(name)
+				count++
+				break
+			}
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+
+	return sum / float64(count)
+}
@@ -0,0 +1,177 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+)
+
+// PowerEstimate is the number of repetitions per cell needed to detect a
+// difference between two strategies, computed from pilot data.
+type PowerEstimate struct {
+	Containers  int
+	First       Summary
+	Second      Summary
+	Repetitions int
+}
+
+// SampleSize returns the repetitions per group needed by a two-sided Welch
+// t-test to detect difference with the given alpha and power, when the groups
+// have standard deviations sd1 and sd2. The power is that of the noncentral t
+// distribution, as computed by R's power.t.test.
+func SampleSize(sd1 float64, sd2 float64, difference float64, alpha float64, power float64) int {
+	variance := sd1*sd1 + sd2*sd2
+	if variance == 0 {
+		return 2
+	}
+
+	// The normal approximation is a close lower bound to start from.
+	z := NormalQuantile(1-alpha/2) + NormalQuantile(power)
+	n := int(math.Max(math.Ceil(z*z*variance/(difference*difference)), 2))
+
+	for testPower(n, sd1, sd2, difference, alpha) < power {
+		n++
+	}
+	for n > 2 && testPower(n-1, sd1, sd2, difference, alpha) >= power {
+		n--
+	}
+
+	return n
+}
+
+// testPower is the probability that the Welch t-test of two groups of n
+// samples rejects equality at level alpha when the means differ by
+// difference, ignoring the negligible opposite tail like power.t.test.
+func testPower(n int, sd1 float64, sd2 float64, difference float64, alpha float64) float64 {
+	variance := sd1*sd1 + sd2*sd2
+	df := float64(n-1) * variance * variance / (math.Pow(sd1, 4) + math.Pow(sd2, 4))
+	noncentrality := math.Abs(difference) / math.Sqrt(variance/float64(n))
+
+	return noncentralTSurvival(StudentTQuantile(1-alpha/2, df), df, noncentrality)
+}
+
+// noncentralTSurvival returns P(T > t) for a noncentral t distribution. T is
+// (Z + noncentrality) / S with S² a chi-square over df, so the probability is
+// that of the normal tail averaged over the density of S, integrated with
+// Simpson's rule.
+func noncentralTSurvival(t float64, df float64, noncentrality float64) float64 {
+	const intervals = 4000
+
+	lgamma, _ := math.Lgamma(df / 2)
+	density := func(s float64) float64 {
+		if s <= 0 {
+			return 0
+		}
+		v := df * s * s
+		return math.Exp((df/2-1)*math.Log(v)-v/2-df/2*math.Ln2-lgamma) * 2 * df * s
+	}
+	integrand := func(s float64) float64 {
+		return density(s) * 0.5 * math.Erfc((t*s-noncentrality)/math.Sqrt2)
+	}
+
+	// S is concentrated around 1 with a spread of about 1/sqrt(2 df).
+	high := 1 + 15/math.Sqrt(2*df)
+	step := high / intervals
+	sum := integrand(0) + integrand(high)
+	for i := 1; i < intervals; i++ {
+		weight := 2.0
+		if i%2 == 1 {
+			weight = 4
+		}
+		sum += weight * integrand(float64(i)*step)
+	}
+
+	return sum * step / 3
+}
+
+// EstimatePower computes the repetitions needed for every container count in
+// the scenario for which both strategies have at least two pilot samples.
+func EstimatePower(scenario Scenario, first string, second string, difference float64, alpha float64, power float64) ([]PowerEstimate, error) {
+	if difference <= 0 {
+		return nil, fmt.Errorf("the minimal detectable difference must be positive, got %v", difference)
+	}
+
+	g := newGrid(scenario)
+	var estimates []PowerEstimate
+
+	for _, containers := range g.containers {
+		a, okA := g.cell(first, containers)
+		b, okB := g.cell(second, containers)
+		if !okA || !okB || a.Summary.N < 2 || b.Summary.N < 2 {
+			continue
+		}
+
+		estimates = append(estimates, PowerEstimate{
+			Containers:  containers,
+			First:       a.Summary,
+			Second:      b.Summary,
+			Repetitions: SampleSize(a.Summary.StdDev, b.Summary.StdDev, difference, alpha, power),
+		})
+	}
+
+	if len(estimates) == 0 {
+		return nil, fmt.Errorf("no pilot data for both %s and %s in %s", first, second, scenario.Table)
+	}
+
+	sort.Slice(estimates, func(i, j int) bool { return estimates[i].Containers < estimates[j].Containers })
+
+	return estimates, nil
+}
+
+// MaxRepetitions returns the largest estimate, i.e. the repetitions that give
+// the requested power in every cell.
+func MaxRepetitions(estimates []PowerEstimate) int {
+	max := 0
+	for _, estimate := range estimates {
+		if estimate.Repetitions > max {
+			max = estimate.Repetitions
+		}
+	}
+
+	return max
+}
+
+func WritePower(w io.Writer, first string, second string, estimates []PowerEstimate) error {
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "containers\t%s mean (ms)\t%s sd\t%s mean (ms)\t%s sd\tpilot n\trepetitions\n", first, first, second, second)
+
+	for _, e := range estimates {
+		fmt.Fprintf(writer, "%d\t%.2f\t%.2f\t%.2f\t%.2f\t%d/%d\t%d\n",
+			e.Containers, e.First.Mean, e.First.StdDev, e.Second.Mean, e.Second.StdDev, e.First.N, e.Second.N, e.Repetitions)
+	}
+
+	return writer.Flush()
+}
+
+// NormalQuantile returns the quantile of the standard normal distribution,
+// using Acklam's rational approximation.
+func NormalQuantile(p float64) float64 {
+	a := []float64{-3.969683028665376e+01, 2.209460984245205e+02, -2.759285104469687e+02, 1.383577518672690e+02, -3.066479806614716e+01, 2.506628277459239e+00}
+	b := []float64{-5.447609879822406e+01, 1.615858368580409e+02, -1.556989798598866e+02, 6.680131188771972e+01, -1.328068155288572e+01}
+	c := []float64{-7.784894002430293e-03, -3.223964580411365e-01, -2.400758277161838e+00, -2.549732539343734e+00, 4.374664141464968e+00, 2.938163982698783e+00}
+	d := []float64{7.784695709041462e-03, 3.224671290700398e-01, 2.445134137142996e+00, 3.754408661907416e+00}
+
+	const low = 0.02425
+
+	switch {
+	case p <= 0:
+		return math.Inf(-1)
+	case p >= 1:
+		return math.Inf(1)
+	case p < low:
+		q := math.Sqrt(-2 * math.Log(p))
+		return (((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) /
+			((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+	case p > 1-low:
+		q := math.Sqrt(-2 * math.Log(1-p))
+		return -(((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) /
+			((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+	default:
+		q := p - 0.5
+		r := q * q
+		return (((((a[0]*r+a[1])*r+a[2])*r+a[3])*r+a[4])*r + a[5]) * q /
+			(((((b[0]*r+b[1])*r+b[2])*r+b[3])*r+b[4])*r + 1)
+	}
+}
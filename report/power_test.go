@@ -0,0 +1,96 @@
+package report
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalQuantile(t *testing.T) {
+	tests := []struct {
+		p, want float64
+	}{
+		{0.5, 0},
+		{0.8, 0.8416212335729143},
+		{0.975, 1.959963984540054},
+		{0.025, -1.959963984540054},
+		{0.01, -2.326347874040841},
+		{0.999, 3.090232306167813},
+	}
+
+	for _, test := range tests {
+		if got := NormalQuantile(test.p); math.Abs(got-test.want) > 1e-8 {
+			t.Errorf("NormalQuantile(%v) = %.12f, want %.12f", test.p, got, test.want)
+		}
+	}
+
+	if !math.IsInf(NormalQuantile(0), -1) || !math.IsInf(NormalQuantile(1), 1) {
+		t.Error("the quantiles of 0 and 1 are not infinite")
+	}
+}
+
+func TestSampleSize(t *testing.T) {
+	tests := []struct {
+		name            string
+		sd1, sd2, delta float64
+		alpha, power    float64
+		want            int
+	}{
+		// power.t.test(delta = 1, sd = 1, power = 0.8) gives n = 16.71.
+		{"one sd", 1, 1, 1, 0.05, 0.8, 17},
+		// power.t.test(delta = 0.5, sd = 1, power = 0.8) gives n = 63.77.
+		{"half sd", 1, 1, 0.5, 0.05, 0.8, 64},
+		// power.t.test(delta = 1, sd = 1, power = 0.9) gives n = 22.02.
+		{"power 0.9", 1, 1, 1, 0.05, 0.9, 23},
+		// The scale does not matter, only the ratio of delta to sd.
+		{"milliseconds", 20, 20, 20, 0.05, 0.8, 17},
+		{"no variance", 0, 0, 1, 0.05, 0.8, 2},
+		{"huge difference", 1, 1, 100, 0.05, 0.8, 2},
+	}
+
+	for _, test := range tests {
+		if got := SampleSize(test.sd1, test.sd2, test.delta, test.alpha, test.power); got != test.want {
+			t.Errorf("%s: %d repetitions, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTestPower(t *testing.T) {
+	// The example of power.t.test: n = 20, delta = 1, sd = 1.
+	if got := testPower(20, 1, 1, 1, 0.05); math.Abs(got-0.8689528) > 1e-6 {
+		t.Errorf("power %.7f, want 0.8689528", got)
+	}
+}
+
+func TestEstimatePower(t *testing.T) {
+	scenario := Scenario{Table: "restore_times", Cells: []Cell{
+		{Strategy: "sequential", Containers: 1, Values: []float64{9, 10, 11}},
+		{Strategy: "parallelized", Containers: 1, Values: []float64{9, 10, 11}},
+		{Strategy: "sequential", Containers: 2, Values: []float64{18, 20, 22}},
+		{Strategy: "parallelized", Containers: 2, Values: []float64{18, 20, 22}},
+		{Strategy: "sequential", Containers: 3, Values: []float64{30}},
+	}}
+	for i := range scenario.Cells {
+		scenario.Cells[i].Summary = Summarize(scenario.Cells[i].Values, 0.95)
+	}
+
+	estimates, err := EstimatePower(scenario, "sequential", "parallelized", 1, 0.05, 0.8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(estimates) != 2 || estimates[0].Containers != 1 || estimates[1].Containers != 2 {
+		t.Fatalf("estimates %+v, want 1 and 2 containers", estimates)
+	}
+
+	// Both cells have sd 1 and 2 respectively.
+	if estimates[0].Repetitions != 17 || MaxRepetitions(estimates) != SampleSize(2, 2, 1, 0.05, 0.8) {
+		t.Errorf("repetitions %d and %d", estimates[0].Repetitions, MaxRepetitions(estimates))
+	}
+
+	if _, err := EstimatePower(scenario, "sequential", "parallelized", 0, 0.05, 0.8); err == nil {
+		t.Error("no error for a zero difference")
+	}
+	if _, err := EstimatePower(scenario, "sequential", "pipelined", 1, 0.05, 0.8); err == nil {
+		t.Error("no error without pilot data")
+	}
+}
@@ -0,0 +1,261 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+)
+
+const (
+	VerdictUnchanged = "unchanged"
+	VerdictImproved  = "improved"
+	VerdictRegressed = "REGRESSED"
+	VerdictMissing   = "missing"
+	VerdictZero      = "zero baseline"
+)
+
+// RegressionOptions configures when a difference between two runs counts as a
+// regression: the relative change of the mean must exceed Tolerance and the
+// statistical Test must reject equality at level Alpha. A baseline cell
+// without enough candidate values to compare, or with a zero mean the change
+// cannot be relative to, fails the comparison as well, unless AllowMissing is
+// set.
+type RegressionOptions struct {
+	Tolerance    float64
+	Alpha        float64
+	Test         string
+	AllowMissing bool
+}
+
+type Comparison struct {
+	Table      string
+	Strategy   string
+	Containers int
+	Baseline   Summary
+	Candidate  Summary
+	Change     float64
+	PValue     float64
+	Verdict    string
+}
+
+// Tests lists the supported statistical tests.
+var Tests = map[string]func(a []float64, b []float64) float64{
+	"welch":       WelchTTest,
+	"mannwhitney": MannWhitneyU,
+}
+
+// Compare matches the cells of baseline and candidate by scenario, strategy and
+// container count and classifies every pair.
+func Compare(baseline *Report, candidate *Report, options RegressionOptions) ([]Comparison, error) {
+	test, ok := Tests[options.Test]
+	if !ok {
+		return nil, fmt.Errorf("unknown test %q, expected welch or mannwhitney", options.Test)
+	}
+
+	candidateCells := map[string]Cell{}
+	for _, scenario := range candidate.Scenarios {
+		for _, cell := range scenario.Cells {
+			candidateCells[cellKey(scenario.Table, cell)] = cell
+		}
+	}
+
+	var comparisons []Comparison
+	for _, scenario := range baseline.Scenarios {
+		for _, cell := range scenario.Cells {
+			comparison := Comparison{
+				Table:      scenario.Table,
+				Strategy:   cell.Strategy,
+				Containers: cell.Containers,
+				Baseline:   cell.Summary,
+				PValue:     math.NaN(),
+				Verdict:    VerdictMissing,
+			}
+
+			other, ok := candidateCells[cellKey(scenario.Table, cell)]
+			if ok && len(cell.Values) > 1 && len(other.Values) > 1 {
+				comparison.Candidate = other.Summary
+				comparison.PValue = test(cell.Values, other.Values)
+
+				var defined bool
+				comparison.Change, defined = relativeChange(cell.Summary.Mean, other.Summary.Mean)
+				if defined {
+					comparison.Verdict = verdict(comparison, options)
+				} else {
+					comparison.Verdict = VerdictZero
+				}
+			}
+
+			comparisons = append(comparisons, comparison)
+		}
+	}
+
+	sort.SliceStable(comparisons, func(i, j int) bool {
+		if comparisons[i].Table != comparisons[j].Table {
+			return comparisons[i].Table < comparisons[j].Table
+		}
+		if comparisons[i].Strategy != comparisons[j].Strategy {
+			return comparisons[i].Strategy < comparisons[j].Strategy
+		}
+		return comparisons[i].Containers < comparisons[j].Containers
+	})
+
+	return comparisons, nil
+}
+
+// relativeChange is the change from baseline to candidate relative to the
+// baseline. It is not defined when the baseline is zero, unless both are.
+func relativeChange(baseline float64, candidate float64) (float64, bool) {
+	if baseline == 0 {
+		return 0, candidate == 0
+	}
+
+	return (candidate - baseline) / baseline, true
+}
+
+func cellKey(table string, cell Cell) string {
+	return fmt.Sprintf("%s/%s/%d", table, cell.Strategy, cell.Containers)
+}
+
+func verdict(comparison Comparison, options RegressionOptions) string {
+	if comparison.PValue >= options.Alpha || math.Abs(comparison.Change) <= options.Tolerance {
+		return VerdictUnchanged
+	}
+
+	if comparison.Change > 0 {
+		return VerdictRegressed
+	}
+
+	return VerdictImproved
+}
+
+// Regressed reports whether any comparison is a significant regression.
+func Regressed(comparisons []Comparison) bool {
+	for _, comparison := range comparisons {
+		if comparison.Verdict == VerdictRegressed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Failed reports whether the comparisons should fail the gate: a significant
+// regression, or a cell that could not be compared unless options allow it.
+func Failed(comparisons []Comparison, options RegressionOptions) bool {
+	if Regressed(comparisons) {
+		return true
+	}
+
+	if options.AllowMissing {
+		return false
+	}
+
+	for _, comparison := range comparisons {
+		if comparison.Verdict == VerdictMissing || comparison.Verdict == VerdictZero {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WriteRegression prints the verdict table.
+func WriteRegression(w io.Writer, comparisons []Comparison) error {
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "scenario\tstrategy\tcontainers\tbaseline (ms)\tcandidate (ms)\tchange\tp-value\tverdict")
+
+	for _, c := range comparisons {
+		if c.Verdict == VerdictMissing {
+			fmt.Fprintf(writer, "%s\t%s\t%d\t%.2f (n=%d)\t-\t-\t-\t%s\n",
+				c.Table, c.Strategy, c.Containers, c.Baseline.Mean, c.Baseline.N, c.Verdict)
+			continue
+		}
+
+		if c.Verdict == VerdictZero {
+			fmt.Fprintf(writer, "%s\t%s\t%d\t%.2f (n=%d)\t%.2f (n=%d)\t-\t%.4f\t%s\n",
+				c.Table, c.Strategy, c.Containers, c.Baseline.Mean, c.Baseline.N, c.Candidate.Mean, c.Candidate.N, c.PValue, c.Verdict)
+			continue
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%.2f (n=%d)\t%.2f (n=%d)\t%+.1f%%\t%.4f\t%s\n",
+			c.Table, c.Strategy, c.Containers, c.Baseline.Mean, c.Baseline.N, c.Candidate.Mean, c.Candidate.N, c.Change*100, c.PValue, c.Verdict)
+	}
+
+	return writer.Flush()
+}
+
+// WelchTTest returns the two-sided p-value of Welch's unequal variances t-test.
+func WelchTTest(a []float64, b []float64) float64 {
+	varianceA := StdDev(a) * StdDev(a) / float64(len(a))
+	varianceB := StdDev(b) * StdDev(b) / float64(len(b))
+	if varianceA+varianceB == 0 {
+		if Mean(a) == Mean(b) {
+			return 1
+		}
+		return 0
+	}
+
+	t := (Mean(b) - Mean(a)) / math.Sqrt(varianceA+varianceB)
+	df := (varianceA + varianceB) * (varianceA + varianceB) /
+		(varianceA*varianceA/float64(len(a)-1) + varianceB*varianceB/float64(len(b)-1))
+
+	return 2 * StudentTCDF(-math.Abs(t), df)
+}
+
+// MannWhitneyU returns the two-sided p-value of the Mann-Whitney U test, using
+// the normal approximation with tie correction.
+func MannWhitneyU(a []float64, b []float64) float64 {
+	type sample struct {
+		value float64
+		group int
+	}
+
+	samples := make([]sample, 0, len(a)+len(b))
+	for _, value := range a {
+		samples = append(samples, sample{value, 0})
+	}
+	for _, value := range b {
+		samples = append(samples, sample{value, 1})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].value < samples[j].value })
+
+	n := float64(len(samples))
+	rankSumA := 0.0
+	tieCorrection := 0.0
+
+	for i := 0; i < len(samples); {
+		j := i
+		for j < len(samples) && samples[j].value == samples[i].value {
+			j++
+		}
+
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if samples[k].group == 0 {
+				rankSumA += rank
+			}
+		}
+
+		ties := float64(j - i)
+		tieCorrection += ties*ties*ties - ties
+		i = j
+	}
+
+	n1 := float64(len(a))
+	n2 := float64(len(b))
+	u := rankSumA - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - tieCorrection/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+
+	z := (math.Abs(u-mean) - 0.5) / sigma
+	if z < 0 {
+		z = 0
+	}
+
+	return math.Erfc(z / math.Sqrt2)
+}
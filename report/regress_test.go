@@ -0,0 +1,139 @@
+package report
+
+import (
+	"math"
+	"testing"
+)
+
+// The sleep data of Student (1908), the reference values are those of R's
+// t.test and wilcox.test.
+var (
+	sleep1 = []float64{0.7, -1.6, -0.2, -1.2, -0.1, 3.4, 3.7, 0.8, 0.0, 2.0}
+	sleep2 = []float64{1.9, 0.8, 1.1, 0.1, -0.1, 4.4, 5.5, 1.6, 4.6, 3.4}
+)
+
+func TestWelchTTest(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"sleep", sleep1, sleep2, 0.07939414},
+		{"symmetric", sleep2, sleep1, 0.07939414},
+		{"equal means", []float64{1, 2, 3}, []float64{0, 2, 4}, 1},
+		{"constant and equal", []float64{2, 2, 2}, []float64{2, 2}, 1},
+		{"constant and different", []float64{2, 2, 2}, []float64{3, 3}, 0},
+	}
+
+	for _, test := range tests {
+		if got := WelchTTest(test.a, test.b); math.Abs(got-test.want) > 1e-6 {
+			t.Errorf("%s: p = %.8f, want %.8f", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		// Normal approximation with continuity and tie correction.
+		{"sleep", sleep1, sleep2, 0.06932758},
+		{"identical", []float64{1, 2, 3}, []float64{1, 2, 3}, 1},
+		{"constant", []float64{5, 5, 5}, []float64{5, 5}, 1},
+	}
+
+	for _, test := range tests {
+		if got := MannWhitneyU(test.a, test.b); math.Abs(got-test.want) > 1e-6 {
+			t.Errorf("%s: p = %.8f, want %.8f", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRelativeChange(t *testing.T) {
+	tests := []struct {
+		baseline, candidate float64
+		want                float64
+		defined             bool
+	}{
+		{100, 110, 0.1, true},
+		{100, 50, -0.5, true},
+		{0, 0, 0, true},
+		{0, 5, 0, false},
+	}
+
+	for _, test := range tests {
+		got, defined := relativeChange(test.baseline, test.candidate)
+		if defined != test.defined || math.Abs(got-test.want) > 1e-12 {
+			t.Errorf("relativeChange(%v, %v) = %v, %v, want %v, %v", test.baseline, test.candidate, got, defined, test.want, test.defined)
+		}
+	}
+}
+
+func testReport(table string, cells ...Cell) *Report {
+	for i := range cells {
+		cells[i].Summary = Summarize(cells[i].Values, 0.95)
+	}
+
+	return &Report{Scenarios: []Scenario{{Table: table, Cells: cells}}}
+}
+
+func TestCompare(t *testing.T) {
+	baseline := testReport("total_times",
+		Cell{Strategy: "same", Containers: 1, Values: []float64{100, 101, 99, 100, 102, 98}},
+		Cell{Strategy: "slower", Containers: 1, Values: []float64{100, 101, 99, 100, 102, 98}},
+		Cell{Strategy: "faster", Containers: 1, Values: []float64{100, 101, 99, 100, 102, 98}},
+		Cell{Strategy: "gone", Containers: 1, Values: []float64{100, 101, 99}},
+		Cell{Strategy: "zero", Containers: 1, Values: []float64{0, 0, 0}},
+	)
+	candidate := testReport("total_times",
+		Cell{Strategy: "same", Containers: 1, Values: []float64{101, 100, 99, 101, 100, 99}},
+		Cell{Strategy: "slower", Containers: 1, Values: []float64{150, 151, 149, 150, 152, 148}},
+		Cell{Strategy: "faster", Containers: 1, Values: []float64{50, 51, 49, 50, 52, 48}},
+		Cell{Strategy: "zero", Containers: 1, Values: []float64{5, 6, 4}},
+	)
+
+	options := RegressionOptions{Tolerance: 0.05, Alpha: 0.05, Test: "welch"}
+	comparisons, err := Compare(baseline, candidate, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"same":   VerdictUnchanged,
+		"slower": VerdictRegressed,
+		"faster": VerdictImproved,
+		"gone":   VerdictMissing,
+		"zero":   VerdictZero,
+	}
+	for _, comparison := range comparisons {
+		if comparison.Verdict != want[comparison.Strategy] {
+			t.Errorf("%s: verdict %s, want %s", comparison.Strategy, comparison.Verdict, want[comparison.Strategy])
+		}
+		if math.IsInf(comparison.Change, 0) || math.IsNaN(comparison.Change) {
+			t.Errorf("%s: change %v", comparison.Strategy, comparison.Change)
+		}
+	}
+
+	if !Failed(comparisons, options) {
+		t.Error("a regression does not fail the gate")
+	}
+
+	var unusable []Comparison
+	for _, comparison := range comparisons {
+		if comparison.Verdict == VerdictMissing || comparison.Verdict == VerdictZero {
+			unusable = append(unusable, comparison)
+		}
+	}
+	if !Failed(unusable, options) {
+		t.Error("missing and zero baseline cells do not fail the gate")
+	}
+	if Failed(unusable, RegressionOptions{AllowMissing: true}) {
+		t.Error("missing and zero baseline cells fail the gate although allowed")
+	}
+
+	if _, err := Compare(baseline, candidate, RegressionOptions{Test: "anova"}); err == nil {
+		t.Error("no error for an unknown test")
+	}
+}
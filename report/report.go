@@ -0,0 +1,299 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/leonardopoggiani/lmo-performance-evaluation/pkg"
+	"github.com/withmandala/go-log"
+)
+
+// Scenarios lists the tables holding durations that are summarised in a report.
+var Scenarios = []string{"checkpoint_times", "restore_times", "total_times", "triangularized_times", "latency"}
+
+type Run struct {
+	ID          string
+	Kind        string
+	Started     time.Time
+	Finished    *time.Time
+	Fingerprint pkg.Fingerprint
+}
+
+// Filter restricts the rows that end up in a report. A zero Since or Until
+// leaves that side of the time window open.
+type Filter struct {
+	RunID string
+	Since time.Time
+	Until time.Time
+}
+
+type Cell struct {
+	Strategy   string
+	Containers int
+	Values     []float64
+	Summary    Summary
+}
+
+type Scenario struct {
+	Table string
+	Query string
+	Note  string
+	Cells []Cell
+}
+
+type FailedTrial struct {
+	Timestamp   time.Time
+	MigrationID string
+	Containers  int
+	Strategy    string
+	Phase       string
+	ErrorClass  string
+	Error       string
+}
+
+type Report struct {
+	Generated   time.Time
+	Run         *Run
+	Filter      Filter
+	Fingerprint pkg.Fingerprint
+	Scenarios   []Scenario
+	Histograms  []LatencyHistogram
+	Phases      []PhaseBreakdown
+	Clock       *ClockSummary
+	Transfers   []TransferSummary
+	Compression []CompressionSummary
+	Failures    []FailedTrial
+}
+
+func LoadRun(ctx context.Context, conn *pgx.Conn, id string) (*Run, error) {
+	run := Run{}
+	var fingerprint []byte
+
+	err := conn.QueryRow(ctx, "SELECT id, kind, started, finished, fingerprint FROM runs WHERE id = $1", id).
+		Scan(&run.ID, &run.Kind, &run.Started, &run.Finished, &fingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("run %s: %w", id, err)
+	}
+
+	if len(fingerprint) > 0 {
+		if err := json.Unmarshal(fingerprint, &run.Fingerprint); err != nil {
+			return nil, err
+		}
+	}
+
+	return &run, nil
+}
+
+// Window returns the time window covered by the run. A run that never
+// finished extends up to now.
+func (r *Run) Window() (time.Time, time.Time) {
+	if r.Finished == nil {
+		return r.Started, time.Now()
+	}
+
+	return r.Started, *r.Finished
+}
+
+// Load builds a report out of the scenario tables. When the filter names a run,
+// the time window of that run is used.
+func Load(ctx context.Context, conn *pgx.Conn, filter Filter) (*Report, error) {
+	logger := log.New(os.Stderr).WithColor()
+
+	report := &Report{
+		Generated:   time.Now(),
+		Filter:      filter,
+		Fingerprint: pkg.CollectFingerprint(nil),
+	}
+
+	if filter.RunID != "" {
+		run, err := LoadRun(ctx, conn, filter.RunID)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Run = run
+		report.Filter.Since, report.Filter.Until = run.Window()
+		report.Fingerprint = run.Fingerprint
+	}
+
+	for _, table := range Scenarios {
+		scenario, err := LoadScenario(ctx, conn, table, report.Filter)
+		if err != nil {
+			logger.Errorf("Skipping %s: %v", table, err)
+			continue
+		}
+
+		if len(scenario.Cells) > 0 {
+			report.Scenarios = append(report.Scenarios, *scenario)
+		}
+	}
+
+	endToEnd, err := LoadEndToEnd(ctx, conn, report.Filter)
+	if err != nil {
+		logger.Errorf("Skipping %s: %v", EndToEndTable, err)
+	} else if len(endToEnd.Cells) > 0 {
+		report.Scenarios = append(report.Scenarios, *endToEnd)
+	}
+
+	phases, err := LoadPhaseBreakdowns(ctx, conn, report.Filter)
+	if err != nil {
+		logger.Errorf("Skipping migration phases: %v", err)
+	}
+	report.Phases = phases
+
+	transfers, err := LoadTransfers(ctx, conn, report.Filter, phases)
+	if err != nil {
+		logger.Errorf("Skipping transfers: %v", err)
+	}
+	report.Transfers = transfers
+
+	compressions, err := LoadCompressions(ctx, conn, report.Filter)
+	if err != nil {
+		logger.Errorf("Skipping compressions: %v", err)
+	}
+	report.Compression = compressions
+
+	clock, err := LoadClockSummary(ctx, conn, report.Filter)
+	if err != nil {
+		logger.Errorf("Skipping clock offsets: %v", err)
+	}
+	report.Clock = clock
+
+	histograms, err := LoadHistograms(ctx, conn, report.Filter)
+	if err != nil {
+		logger.Errorf("Skipping latency histograms: %v", err)
+	}
+	report.Histograms = histograms
+
+	failures, err := LoadFailures(ctx, conn, report.Filter)
+	if err != nil {
+		logger.Errorf("Skipping failed trials: %v", err)
+	}
+	report.Failures = failures
+
+	return report, nil
+}
+
+// whereClause renders the time window of filter as a SQL condition and its
+// arguments.
+func whereClause(filter Filter) (string, []any) {
+	var conditions []string
+	var args []any
+
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		conditions = append(conditions, fmt.Sprintf("timestamp >= $%d", len(args)))
+	}
+
+	if !filter.Until.IsZero() {
+		args = append(args, filter.Until)
+		conditions = append(conditions, fmt.Sprintf("timestamp <= $%d", len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// strategyColumns names the strategy of the tables where the checkpoint type
+// alone does not tell it: the rows of total_times also carry the restore
+// strategy of the receiver.
+var strategyColumns = map[string]string{
+	"total_times": "checkpoint_type || COALESCE(' ' || restore_strategy, '')",
+}
+
+// scenarioNotes explain the keys of the tables whose meaning changed over time.
+var scenarioNotes = map[string]string{
+	"total_times": "checkpoint is the checkpoint time of the sender, restore the restore time of the receiver. " +
+		"Both were stored as restore before migration IDs, init relabels the sender rows that carry one.",
+}
+
+// LoadScenario reads every row of table in the filter window and groups the
+// elapsed times, converted to milliseconds, by strategy and container count.
+func LoadScenario(ctx context.Context, conn *pgx.Conn, table string, filter Filter) (*Scenario, error) {
+	column, ok := strategyColumns[table]
+	if !ok {
+		column = "checkpoint_type"
+	}
+
+	where, args := whereClause(filter)
+	query := fmt.Sprintf("SELECT %s AS strategy, containers, elapsed FROM %s%s ORDER BY strategy, containers", column, table, where)
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scenario := &Scenario{Table: table, Query: query, Note: scenarioNotes[table]}
+	index := map[string]int{}
+
+	for rows.Next() {
+		var strategy *string
+		var containers *int
+		var elapsed *float64
+
+		if err := rows.Scan(&strategy, &containers, &elapsed); err != nil {
+			return nil, err
+		}
+
+		if elapsed == nil || containers == nil {
+			continue
+		}
+
+		name := ""
+		if strategy != nil {
+			name = *strategy
+		}
+
+		key := fmt.Sprintf("%s/%d", name, *containers)
+		position, ok := index[key]
+		if !ok {
+			scenario.Cells = append(scenario.Cells, Cell{Strategy: name, Containers: *containers})
+			position = len(scenario.Cells) - 1
+			index[key] = position
+		}
+
+		scenario.Cells[position].Values = append(scenario.Cells[position].Values, *elapsed/float64(time.Millisecond))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range scenario.Cells {
+		scenario.Cells[i].Summary = Summarize(scenario.Cells[i].Values, 0.95)
+	}
+
+	return scenario, nil
+}
+
+func LoadFailures(ctx context.Context, conn *pgx.Conn, filter Filter) ([]FailedTrial, error) {
+	where, args := whereClause(filter)
+	query := "SELECT timestamp, COALESCE(migration_id, ''), containers, checkpoint_type, phase, COALESCE(error_class, ''), error FROM failed_trials" + where + " ORDER BY timestamp"
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []FailedTrial
+	for rows.Next() {
+		failure := FailedTrial{}
+		if err := rows.Scan(&failure.Timestamp, &failure.MigrationID, &failure.Containers, &failure.Strategy, &failure.Phase, &failure.ErrorClass, &failure.Error); err != nil {
+			return nil, err
+		}
+
+		failures = append(failures, failure)
+	}
+
+	return failures, rows.Err()
+}
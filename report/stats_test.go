@@ -0,0 +1,84 @@
+package report
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStudentTCDF(t *testing.T) {
+	tests := []struct {
+		t, df, want float64
+	}{
+		{0, 5, 0.5},
+		// Cauchy distribution.
+		{1, 1, 0.75},
+		{-1, 1, 0.25},
+		// Closed form for two degrees of freedom: 1/2 + t / (2 sqrt(2 + t²)).
+		{1, 2, 0.7886751345948129},
+		{-3, 2, 0.04773298313335455},
+		// Critical values of the t tables.
+		{12.706204736174698, 1, 0.975},
+		{2.228138851986274, 10, 0.975},
+		{1.812461122811676, 10, 0.95},
+		{2.042272456301238, 30, 0.975},
+		{-2.570581835636314, 5, 0.025},
+	}
+
+	for _, test := range tests {
+		if got := StudentTCDF(test.t, test.df); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("StudentTCDF(%v, %v) = %.12f, want %.12f", test.t, test.df, got, test.want)
+		}
+	}
+}
+
+func TestStudentTQuantile(t *testing.T) {
+	tests := []struct {
+		p, df, want float64
+	}{
+		{0.5, 7, 0},
+		{0.975, 1, 12.706204736174698},
+		{0.975, 2, 4.302652729749464},
+		{0.975, 5, 2.570581835636314},
+		{0.975, 10, 2.228138851986274},
+		{0.975, 30, 2.042272456301238},
+		{0.95, 10, 1.812461122811676},
+		{0.9, 10, 1.372183641110336},
+		{0.025, 5, -2.570581835636314},
+	}
+
+	for _, test := range tests {
+		if got := StudentTQuantile(test.p, test.df); math.Abs(got-test.want) > 1e-7 {
+			t.Errorf("StudentTQuantile(%v, %v) = %.10f, want %.10f", test.p, test.df, got, test.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	summary := Summarize([]float64{5, 1, 4, 2, 3}, 0.95)
+
+	// The interval is mean ± t(0.975, 4) s / sqrt(n).
+	halfWidth := 2.7764451051977987 * math.Sqrt(2.5) / math.Sqrt(5)
+	want := Summary{N: 5, Mean: 3, StdDev: math.Sqrt(2.5), Min: 1, Max: 5, Median: 3, P95: 4.8, CILow: 3 - halfWidth, CIHigh: 3 + halfWidth}
+
+	for _, field := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"mean", summary.Mean, want.Mean},
+		{"stddev", summary.StdDev, want.StdDev},
+		{"min", summary.Min, want.Min},
+		{"max", summary.Max, want.Max},
+		{"median", summary.Median, want.Median},
+		{"p95", summary.P95, want.P95},
+		{"ci low", summary.CILow, want.CILow},
+		{"ci high", summary.CIHigh, want.CIHigh},
+	} {
+		if math.Abs(field.got-field.want) > 1e-7 {
+			t.Errorf("%s = %v, want %v", field.name, field.got, field.want)
+		}
+	}
+
+	if summary.N != want.N {
+		t.Errorf("n = %d, want %d", summary.N, want.N)
+	}
+}
@@ -0,0 +1,227 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Units maps the supported time units to their size in milliseconds, the unit
+// the summaries are computed in.
+var Units = map[string]float64{
+	"us": 0.001,
+	"ms": 1,
+	"s":  1000,
+}
+
+// TableOptions controls how the numbers of a LaTeX or Markdown table are
+// printed.
+type TableOptions struct {
+	Unit   string
+	Digits int
+}
+
+// ParseTableOptions validates unit and digits.
+func ParseTableOptions(unit string, digits int) (TableOptions, error) {
+	if _, ok := Units[unit]; !ok {
+		return TableOptions{}, fmt.Errorf("unknown unit %q, expected one of us, ms, s", unit)
+	}
+
+	if digits < 1 {
+		return TableOptions{}, fmt.Errorf("significant digits must be at least 1, got %d", digits)
+	}
+
+	return TableOptions{Unit: unit, Digits: digits}, nil
+}
+
+// grid arranges the cells of a scenario with one row per container count and
+// one column per strategy.
+type grid struct {
+	strategies []string
+	containers []int
+	cells      map[string]Cell
+}
+
+func newGrid(scenario Scenario) grid {
+	g := grid{cells: map[string]Cell{}}
+	seenStrategies := map[string]bool{}
+	seenContainers := map[int]bool{}
+
+	for _, cell := range scenario.Cells {
+		if !seenStrategies[cell.Strategy] {
+			seenStrategies[cell.Strategy] = true
+			g.strategies = append(g.strategies, cell.Strategy)
+		}
+		if !seenContainers[cell.Containers] {
+			seenContainers[cell.Containers] = true
+			g.containers = append(g.containers, cell.Containers)
+		}
+		g.cells[fmt.Sprintf("%s/%d", cell.Strategy, cell.Containers)] = cell
+	}
+
+	sort.Strings(g.strategies)
+	sort.Ints(g.containers)
+
+	return g
+}
+
+func (g grid) cell(strategy string, containers int) (Cell, bool) {
+	cell, ok := g.cells[fmt.Sprintf("%s/%d", strategy, containers)]
+	return cell, ok
+}
+
+// decimals returns how many decimal places keep digits significant digits of
+// value.
+func decimals(value float64, digits int) int {
+	if value == 0 {
+		return digits - 1
+	}
+
+	return digits - 1 - int(math.Floor(math.Log10(math.Abs(value))))
+}
+
+// formatPlaces prints value with the given number of decimal places. Negative
+// places round to tens, hundreds and so on.
+func formatPlaces(value float64, places int) string {
+	if places >= 0 {
+		return strconv.FormatFloat(value, 'f', places, 64)
+	}
+
+	scale := math.Pow(10, float64(-places))
+	return strconv.FormatFloat(math.Round(value/scale)*scale, 'f', 0, 64)
+}
+
+// meanAndError formats the mean with the requested significant digits and the
+// CI half-width with the same number of decimal places, so they line up.
+func meanAndError(summary Summary, options TableOptions) (string, string) {
+	scale := Units[options.Unit]
+	mean := summary.Mean / scale
+	halfWidth := (summary.CIHigh - summary.Mean) / scale
+
+	places := decimals(mean, options.Digits)
+	return formatPlaces(mean, places), formatPlaces(halfWidth, places)
+}
+
+// describeFilter renders the filters applied to the report, so tables can be
+// traced back to the data they were computed from.
+func describeFilter(report *Report) string {
+	var parts []string
+
+	if report.Filter.RunID != "" {
+		parts = append(parts, "run="+report.Filter.RunID)
+	}
+	if !report.Filter.Since.IsZero() {
+		parts = append(parts, "since="+report.Filter.Since.Format(time.RFC3339))
+	}
+	if !report.Filter.Until.IsZero() {
+		parts = append(parts, "until="+report.Filter.Until.Format(time.RFC3339))
+	}
+
+	if len(parts) == 0 {
+		return "none"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func latexEscape(value string) string {
+	replacer := strings.NewReplacer(`\`, `\textbackslash{}`, "_", `\_`, "%", `\%`, "&", `\&`, "#", `\#`, "$", `\$`, "{", `\{`, "}", `\}`)
+	return replacer.Replace(value)
+}
+
+// WriteLaTeX prints a booktabs table of mean ± 95% CI per strategy and container
+// count for every scenario.
+func WriteLaTeX(w io.Writer, report *Report, options TableOptions) error {
+	for _, scenario := range report.Scenarios {
+		g := newGrid(scenario)
+
+		fmt.Fprintf(w, "%% Generated %s\n", report.Generated.Format(time.RFC3339))
+		fmt.Fprintf(w, "%% Query: %s\n", scenario.Query)
+		fmt.Fprintf(w, "%% Filters: %s\n", describeFilter(report))
+		if scenario.Note != "" {
+			fmt.Fprintf(w, "%% Note: %s\n", scenario.Note)
+		}
+		fmt.Fprintln(w, `\begin{table}[ht]`)
+		fmt.Fprintln(w, `\centering`)
+		fmt.Fprintf(w, "\\caption{%s (%s, mean $\\pm$ 95\\%% CI)}\n", latexEscape(scenario.Table), latexEscape(options.Unit))
+		fmt.Fprintf(w, "\\label{tab:%s}\n", scenario.Table)
+		fmt.Fprintf(w, "\\begin{tabular}{r%s}\n", strings.Repeat("c", len(g.strategies)))
+		fmt.Fprintln(w, `\toprule`)
+
+		header := []string{"Containers"}
+		for _, strategy := range g.strategies {
+			header = append(header, latexEscape(strategy))
+		}
+		fmt.Fprintf(w, "%s \\\\\n", strings.Join(header, " & "))
+		fmt.Fprintln(w, `\midrule`)
+
+		for _, containers := range g.containers {
+			row := []string{strconv.Itoa(containers)}
+			for _, strategy := range g.strategies {
+				cell, ok := g.cell(strategy, containers)
+				if !ok {
+					row = append(row, "--")
+					continue
+				}
+
+				mean, halfWidth := meanAndError(cell.Summary, options)
+				row = append(row, fmt.Sprintf("$%s \\pm %s$", mean, halfWidth))
+			}
+			fmt.Fprintf(w, "%s \\\\\n", strings.Join(row, " & "))
+		}
+
+		fmt.Fprintln(w, `\bottomrule`)
+		fmt.Fprintln(w, `\end{tabular}`)
+		fmt.Fprintln(w, `\end{table}`)
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
+
+// WriteMarkdown prints the same tables as WriteLaTeX in Markdown, with the
+// query and filters in an HTML comment.
+func WriteMarkdown(w io.Writer, report *Report, options TableOptions) error {
+	for _, scenario := range report.Scenarios {
+		g := newGrid(scenario)
+
+		fmt.Fprintf(w, "<!--\nGenerated: %s\nQuery: %s\nFilters: %s\n", report.Generated.Format(time.RFC3339), scenario.Query, describeFilter(report))
+		if scenario.Note != "" {
+			fmt.Fprintf(w, "Note: %s\n", scenario.Note)
+		}
+		fmt.Fprintln(w, "-->")
+		fmt.Fprintf(w, "**%s** (%s, mean ± 95%% CI)\n\n", scenario.Table, options.Unit)
+
+		header := []string{"Containers"}
+		align := []string{"---:"}
+		for _, strategy := range g.strategies {
+			header = append(header, strategy)
+			align = append(align, ":---:")
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+		fmt.Fprintf(w, "| %s |\n", strings.Join(align, " | "))
+
+		for _, containers := range g.containers {
+			row := []string{strconv.Itoa(containers)}
+			for _, strategy := range g.strategies {
+				cell, ok := g.cell(strategy, containers)
+				if !ok {
+					row = append(row, "–")
+					continue
+				}
+
+				mean, halfWidth := meanAndError(cell.Summary, options)
+				row = append(row, fmt.Sprintf("%s ± %s", mean, halfWidth))
+			}
+			fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// WriteText prints the per-scenario summary tables in plain text.
+func WriteText(w io.Writer, report *Report) error {
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	for _, scenario := range report.Scenarios {
+		fmt.Fprintf(writer, "== %s ==\n", scenario.Table)
+		if scenario.Note != "" {
+			fmt.Fprintln(writer, scenario.Note)
+		}
+		fmt.Fprintln(writer, "strategy\tcontainers\tn\tmean (ms)\tstddev\tmedian\tp95\t95% CI")
+
+		for _, cell := range scenario.Cells {
+			s := cell.Summary
+			fmt.Fprintf(writer, "%s\t%d\t%d\t%.2f\t%.2f\t%.2f\t%.2f\t[%.2f, %.2f]\n",
+				cell.Strategy, cell.Containers, s.N, s.Mean, s.StdDev, s.Median, s.P95, s.CILow, s.CIHigh)
+		}
+
+		fmt.Fprintln(writer)
+	}
+
+	if len(report.Histograms) > 0 {
+		fmt.Fprintln(writer, "== latency histograms ==")
+		fmt.Fprint(writer, "target\tphase\tn\tfailures\tmean (ms)")
+		for _, q := range Quantiles {
+			fmt.Fprintf(writer, "\tp%v", q*100)
+		}
+		fmt.Fprintln(writer, "\tmax")
+
+		for _, h := range report.Histograms {
+			fmt.Fprintf(writer, "%s\t%s\t%d\t%d\t%.3f", h.Target, h.Phase, h.Histogram.TotalCount(), h.Failures, h.MeanMillis())
+			for _, q := range Quantiles {
+				fmt.Fprintf(writer, "\t%.3f", h.QuantileMillis(q))
+			}
+			fmt.Fprintf(writer, "\t%.3f\n", h.MaxMillis())
+		}
+
+		fmt.Fprintln(writer)
+	}
+
+	if len(report.Phases) > 0 {
+		names := PhaseNames(report.Phases)
+
+		fmt.Fprintln(writer, "== migration phases (ms) ==")
+		fmt.Fprint(writer, "migration")
+		for _, name := range names {
+			fmt.Fprintf(writer, "\t%s", name)
+		}
+		fmt.Fprintln(writer, "\ttotal")
+
+		for _, breakdown := range report.Phases {
+			id := breakdown.MigrationID
+			if breakdown.Failed() {
+				id += " (failed)"
+			}
+
+			fmt.Fprint(writer, id)
+			for _, name := range names {
+				fmt.Fprintf(writer, "\t%.1f", breakdown.Millis(name))
+			}
+			fmt.Fprintf(writer, "\t%.1f\n", breakdown.TotalMillis())
+		}
+
+		fmt.Fprint(writer, "mean")
+		for _, name := range names {
+			fmt.Fprintf(writer, "\t%.1f", MeanPhaseMillis(report.Phases, name))
+		}
+		fmt.Fprint(writer, "\t\n\n")
+	}
+
+	if len(report.Transfers) > 0 {
+		fmt.Fprintln(writer, "== transfers ==")
+		fmt.Fprintln(writer, "transport\tlink\tn\tmean (ms)\tmean (MB)\tmean (MB/s)\tshare of migration")
+		for _, t := range report.Transfers {
+			fmt.Fprintf(writer, "%s\t%s\t%d\t%.1f\t%.2f\t%.2f\t%.1f%%\n", t.Transport, t.Link, t.N, t.MeanMillis, t.MeanMegabytes, t.MeanThroughput, t.SharePercent())
+		}
+		fmt.Fprintln(writer)
+	}
+
+	if len(report.Compression) > 0 {
+		fmt.Fprintln(writer, "== compression ==")
+		fmt.Fprintln(writer, "codec\tn\tmean ratio\tmean raw (MB)\tcompress (MB/s)\tdecompress (MB/s)\tpays off below (MB/s)")
+		for _, c := range report.Compression {
+			fmt.Fprintf(writer, "%s\t%d\t%.2f\t%.2f\t%.1f\t%.1f\t%.1f\n",
+				c.Compression, c.N, c.MeanRatio, c.MeanMegabytes, c.CompressSpeed, c.DecompressSpeed, c.BreakEven)
+		}
+		fmt.Fprintln(writer)
+	}
+
+	if report.Clock != nil {
+		c := report.Clock
+		fmt.Fprintln(writer, "== clock offsets ==")
+		fmt.Fprintln(writer, "n\tmin offset (ms)\tmax offset (ms)\tmax uncertainty (ms)")
+		fmt.Fprintf(writer, "%d\t%.3f\t%.3f\t%.3f\n\n", c.N, c.MinOffset, c.MaxOffset, c.MaxUncertainty)
+	}
+
+	if len(report.Failures) > 0 {
+		fmt.Fprintln(writer, "== failed trials ==")
+		for _, failure := range report.Failures {
+			fmt.Fprintf(writer, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+				failure.Timestamp.Format("2006-01-02 15:04:05"), failure.MigrationID, failure.Containers, failure.Strategy, failure.Phase,
+				failure.ErrorClass, failure.Error)
+		}
+	}
+
+	return writer.Flush()
+}
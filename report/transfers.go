@@ -0,0 +1,98 @@
+package report
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TransferSummary describes the transfers made with a transport over a link
+// in the report window, with the throughput in MB/s. Share is the part of the migration time, the sum of its phases,
+// spent in the transfer, over the migrations whose phases were recorded.
+type TransferSummary struct {
+	Transport      string
+	Link           string
+	N              int
+	MeanMillis     float64
+	MeanMegabytes  float64
+	MeanThroughput float64
+	Share          float64
+}
+
+func (s TransferSummary) SharePercent() float64 {
+	return s.Share * 100
+}
+
+// LoadTransfers summarises the transfers of the filter window per transport
+// and emulated link, in the order they were first used.
+func LoadTransfers(ctx context.Context, conn *pgx.Conn, filter Filter, phases []PhaseBreakdown) ([]TransferSummary, error) {
+	where, args := whereClause(filter)
+	query := "SELECT COALESCE(migration_id, ''), transport, COALESCE(link, 'none'), bytes, elapsed, throughput FROM transfers" + where + " ORDER BY timestamp"
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := map[string]float64{}
+	for _, breakdown := range phases {
+		totals[breakdown.MigrationID] = breakdown.TotalMillis()
+	}
+
+	var summaries []TransferSummary
+	index := map[string]int{}
+	transferMillis := map[string]float64{}
+	migrationMillis := map[string]float64{}
+
+	for rows.Next() {
+		var id, transport, link string
+		var bytes int64
+		var elapsed, throughput float64
+
+		if err := rows.Scan(&id, &transport, &link, &bytes, &elapsed, &throughput); err != nil {
+			return nil, err
+		}
+
+		key := transport + " " + link
+		position, ok := index[key]
+		if !ok {
+			summaries = append(summaries, TransferSummary{Transport: transport, Link: link})
+			position = len(summaries) - 1
+			index[key] = position
+		}
+
+		millis := elapsed / float64(time.Millisecond)
+
+		summary := &summaries[position]
+		summary.N++
+		summary.MeanMillis += millis
+		summary.MeanMegabytes += float64(bytes) / (1024 * 1024)
+		summary.MeanThroughput += throughput / (1024 * 1024)
+
+		if total, ok := totals[id]; ok && total > 0 {
+			transferMillis[key] += millis
+			migrationMillis[key] += total
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range summaries {
+		summary := &summaries[i]
+		n := float64(summary.N)
+		summary.MeanMillis /= n
+		summary.MeanMegabytes /= n
+		summary.MeanThroughput /= n
+
+		key := summary.Transport + " " + summary.Link
+		if migrationMillis[key] > 0 {
+			summary.Share = transferMillis[key] / migrationMillis[key]
+		}
+	}
+
+	return summaries, nil
+}
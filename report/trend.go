@@ -0,0 +1,246 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TrendPoint summarises a cell within a single group, i.e. a run or a day.
+// ChangePoint is set on the group that introduced a step change, Change is
+// relative to the mean before the step unless that mean is zero, in which
+// case FromZero is set instead.
+type TrendPoint struct {
+	Group       string
+	Start       time.Time
+	Values      []float64
+	Summary     Summary
+	ChangePoint bool
+	Change      float64
+	FromZero    bool
+}
+
+type Trend struct {
+	Table      string
+	Strategy   string
+	Containers int
+	Points     []TrendPoint
+}
+
+// trendQueries holds the queries grouping the rows of a table by run or day,
+// given the strategy column and the table. A run ends when it finished or
+// when the next one started, whichever comes first, so that a crashed run or
+// overlapping runs do not take the rows of the next ones.
+var trendQueries = map[string]string{
+	"run": `WITH bounded AS (
+			SELECT id, started, LEAST(COALESCE(finished, 'infinity'), COALESCE(LEAD(started) OVER (ORDER BY started), 'infinity')) AS ended
+			FROM runs
+		)
+		SELECT r.id, r.started, %[1]s, t.containers, t.elapsed FROM %[2]s t
+		JOIN bounded r ON t.timestamp >= r.started AND t.timestamp < r.ended
+		ORDER BY r.started, t.timestamp`,
+	"day": `SELECT to_char(date_trunc('day', timestamp), 'YYYY-MM-DD'), date_trunc('day', timestamp), %[1]s, containers, elapsed FROM %[2]s
+		ORDER BY timestamp`,
+}
+
+// LoadTrends groups the rows of table by run or by day and summarises every
+// cell in every group.
+func LoadTrends(ctx context.Context, conn *pgx.Conn, table string, groupBy string) ([]Trend, error) {
+	query, ok := trendQueries[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown grouping %q, expected run or day", groupBy)
+	}
+
+	column, ok := strategyColumns[table]
+	if !ok {
+		column = "checkpoint_type"
+	}
+
+	rows, err := conn.Query(ctx, fmt.Sprintf(query, column, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trends []Trend
+	index := map[string]int{}
+
+	for rows.Next() {
+		var group string
+		var start time.Time
+		var strategy *string
+		var containers *int
+		var elapsed *float64
+
+		if err := rows.Scan(&group, &start, &strategy, &containers, &elapsed); err != nil {
+			return nil, err
+		}
+
+		if elapsed == nil || containers == nil {
+			continue
+		}
+
+		name := ""
+		if strategy != nil {
+			name = *strategy
+		}
+
+		key := fmt.Sprintf("%s/%d", name, *containers)
+		position, ok := index[key]
+		if !ok {
+			trends = append(trends, Trend{Table: table, Strategy: name, Containers: *containers})
+			position = len(trends) - 1
+			index[key] = position
+		}
+
+		trend := &trends[position]
+		last := len(trend.Points) - 1
+		if last < 0 || trend.Points[last].Group != group {
+			trend.Points = append(trend.Points, TrendPoint{Group: group, Start: start})
+			last++
+		}
+
+		trend.Points[last].Values = append(trend.Points[last].Values, *elapsed/float64(time.Millisecond))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range trends {
+		for j := range trends[i].Points {
+			trends[i].Points[j].Summary = Summarize(trends[i].Points[j].Values, 0.95)
+		}
+	}
+
+	return trends, nil
+}
+
+// MarkChangePoints flags the groups of the trend where the mean steps, using
+// DetectChangePoints on the samples of every group. The change is relative to
+// the segment preceding the step.
+func MarkChangePoints(trend *Trend, alpha float64, minChange float64) {
+	groups := make([][]float64, len(trend.Points))
+	for i, point := range trend.Points {
+		groups[i] = point.Values
+	}
+
+	changePoints := DetectChangePoints(groups, alpha, minChange)
+	boundaries := append(append([]int{0}, changePoints...), len(groups))
+
+	for i, position := range changePoints {
+		before := Mean(flatten(groups[boundaries[i]:position]))
+		after := Mean(flatten(groups[position:boundaries[i+2]]))
+
+		change, defined := relativeChange(before, after)
+		trend.Points[position].ChangePoint = true
+		trend.Points[position].Change = change
+		trend.Points[position].FromZero = !defined
+	}
+}
+
+// DetectChangePoints runs binary segmentation over groups of samples. A segment
+// is split at the group boundary with the largest Welch statistic when the
+// Bonferroni-corrected p-value is below alpha and the relative change of the
+// mean exceeds minChange. It returns the indices of the groups that start a new
+// segment, in increasing order.
+func DetectChangePoints(groups [][]float64, alpha float64, minChange float64) []int {
+	var changePoints []int
+
+	var segment func(low int, high int)
+	segment = func(low int, high int) {
+		if high-low < 2 {
+			return
+		}
+
+		best := -1
+		bestStatistic := 0.0
+		bestLeft, bestRight := []float64(nil), []float64(nil)
+
+		for k := low + 1; k < high; k++ {
+			left := flatten(groups[low:k])
+			right := flatten(groups[k:high])
+			if len(left) < 2 || len(right) < 2 {
+				continue
+			}
+
+			statistic := welchStatistic(left, right)
+			if statistic > bestStatistic {
+				best, bestStatistic = k, statistic
+				bestLeft, bestRight = left, right
+			}
+		}
+
+		if best < 0 {
+			return
+		}
+
+		pValue := WelchTTest(bestLeft, bestRight) * float64(high-low-1)
+		// A step from a zero mean exceeds any relative change.
+		change, defined := relativeChange(Mean(bestLeft), Mean(bestRight))
+		if pValue >= alpha || (defined && math.Abs(change) <= minChange) {
+			return
+		}
+
+		segment(low, best)
+		changePoints = append(changePoints, best)
+		segment(best, high)
+	}
+
+	segment(0, len(groups))
+
+	return changePoints
+}
+
+func welchStatistic(a []float64, b []float64) float64 {
+	variance := StdDev(a)*StdDev(a)/float64(len(a)) + StdDev(b)*StdDev(b)/float64(len(b))
+	if variance == 0 {
+		if Mean(a) == Mean(b) {
+			return 0
+		}
+		return math.Inf(1)
+	}
+
+	return math.Abs(Mean(a)-Mean(b)) / math.Sqrt(variance)
+}
+
+func flatten(groups [][]float64) []float64 {
+	var values []float64
+	for _, group := range groups {
+		values = append(values, group...)
+	}
+
+	return values
+}
+
+// WriteTrends prints how the mean and p95 of every cell evolved, pointing out
+// the groups that introduced a step change.
+func WriteTrends(w io.Writer, trends []Trend) error {
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	for _, trend := range trends {
+		fmt.Fprintf(writer, "== %s, %s, %d containers ==\n", trend.Table, trend.Strategy, trend.Containers)
+		fmt.Fprintln(writer, "group\tstart\tn\tmean (ms)\tp95 (ms)\tchange")
+
+		for _, point := range trend.Points {
+			marker := ""
+			if point.FromZero {
+				marker = "<< step from 0"
+			} else if point.ChangePoint {
+				marker = fmt.Sprintf("<< step %+.1f%%", point.Change*100)
+			}
+
+			fmt.Fprintf(writer, "%s\t%s\t%d\t%.2f\t%.2f\t%s\n",
+				point.Group, point.Start.Format("2006-01-02 15:04"), point.Summary.N, point.Summary.Mean, point.Summary.P95, marker)
+		}
+
+		fmt.Fprintln(writer)
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,78 @@
+package report
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// around returns five samples spread evenly around mean.
+func around(mean float64) []float64 {
+	return []float64{mean - 2, mean - 1, mean, mean + 1, mean + 2}
+}
+
+// groupsOf repeats around(mean) count times for every mean, in turn.
+func groupsOf(count int, means ...float64) [][]float64 {
+	var groups [][]float64
+	for _, mean := range means {
+		for i := 0; i < count; i++ {
+			groups = append(groups, around(mean))
+		}
+	}
+
+	return groups
+}
+
+func TestDetectChangePoints(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups [][]float64
+		want   []int
+	}{
+		{"flat", groupsOf(8, 100), nil},
+		{"single group", groupsOf(1, 100), nil},
+		{"one step", groupsOf(4, 100, 150), []int{4}},
+		{"step back", groupsOf(3, 100, 150, 100), []int{3, 6}},
+		{"two steps up", groupsOf(3, 100, 130, 170), []int{3, 6}},
+		// Significant, but below the minimal relative change.
+		{"small step", groupsOf(4, 100, 104), nil},
+		// A large but noisy step is not significant.
+		{"noisy", [][]float64{{0, 200}, {10, 190}, {60, 260}, {70, 250}}, nil},
+		{"from zero", append([][]float64{{0, 0, 0}, {0, 0, 0}, {0, 0, 0}}, groupsOf(3, 100)...), []int{3}},
+	}
+
+	for _, test := range tests {
+		if got := DetectChangePoints(test.groups, 0.05, 0.1); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: change points %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMarkChangePoints(t *testing.T) {
+	trend := func(groups [][]float64) *Trend {
+		trend := &Trend{}
+		for _, values := range groups {
+			trend.Points = append(trend.Points, TrendPoint{Values: values, Summary: Summarize(values, 0.95)})
+		}
+		return trend
+	}
+
+	step := trend(groupsOf(3, 100, 150))
+	MarkChangePoints(step, 0.05, 0.1)
+
+	for i, point := range step.Points {
+		if point.ChangePoint != (i == 3) {
+			t.Errorf("point %d: change point %v", i, point.ChangePoint)
+		}
+	}
+	if point := step.Points[3]; math.Abs(point.Change-0.5) > 1e-12 || point.FromZero {
+		t.Errorf("change %v, from zero %v, want 0.5", point.Change, point.FromZero)
+	}
+
+	fromZero := trend(append([][]float64{{0, 0, 0}, {0, 0, 0}}, groupsOf(2, 100)...))
+	MarkChangePoints(fromZero, 0.05, 0.1)
+
+	if point := fromZero.Points[2]; !point.ChangePoint || !point.FromZero || math.IsInf(point.Change, 0) || math.IsNaN(point.Change) {
+		t.Errorf("step from zero marked %+v", point)
+	}
+}
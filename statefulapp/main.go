@@ -0,0 +1,121 @@
+// Command statefulapp is the workload used by the consistency probe. It keeps
+// a counter and the history of every write in memory only, so that after a
+// live migration the state it serves tells whether the restored process is the
+// one that was checkpointed or a fresh start.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+type Entry struct {
+	Seq     int64     `json:"seq"`
+	Value   string    `json:"value"`
+	Written time.Time `json:"written"`
+}
+
+// State is what GET /state returns. BootID is generated once when the process
+// starts, so it only survives a checkpoint and restore of that very process.
+type State struct {
+	BootID   string    `json:"boot_id"`
+	PID      int       `json:"pid"`
+	Started  time.Time `json:"started"`
+	Counter  int64     `json:"counter"`
+	Entries  int       `json:"entries"`
+	Checksum string    `json:"checksum"`
+}
+
+type store struct {
+	mu       sync.Mutex
+	bootID   string
+	started  time.Time
+	counter  int64
+	history  []Entry
+	checksum [sha256.Size]byte
+}
+
+func (s *store) state() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return State{
+		BootID:   s.bootID,
+		PID:      os.Getpid(),
+		Started:  s.started,
+		Counter:  s.counter,
+		Entries:  len(s.history),
+		Checksum: hex.EncodeToString(s.checksum[:]),
+	}
+}
+
+// write appends value to the history. The checksum chains every entry, so any
+// lost or altered write changes it.
+func (s *store) write(value string) Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counter++
+	entry := Entry{Seq: s.counter, Value: value, Written: time.Now()}
+	s.history = append(s.history, entry)
+	s.checksum = sha256.Sum256(append(s.checksum[:], value...))
+
+	return entry
+}
+
+func (s *store) entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Entry(nil), s.history...)
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Print(err)
+	}
+}
+
+func main() {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Fatal(err)
+	}
+
+	s := &store{bootID: hex.EncodeToString(id), started: time.Now()}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/state", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.state())
+	})
+	mux.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.entries())
+	})
+	mux.HandleFunc("/write", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		writeJSON(w, s.write(r.URL.Query().Get("value")))
+	})
+
+	address := ":8080"
+	if port := os.Getenv("PORT"); port != "" {
+		address = ":" + port
+	}
+
+	log.Printf("stateful app %s listening on %s", s.bootID, address)
+	log.Fatal(http.ListenAndServe(address, mux))
+}
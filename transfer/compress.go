@@ -0,0 +1,291 @@
+package transfer
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leonardopoggiani/lmo-performance-evaluation/control"
+)
+
+// Codecs the archives can be compressed with before the transfer. Neither
+// zstd nor lz4 is available to this module, so lz is an LZ4-like codec
+// implemented here, fast with a modest ratio, and lzh follows it with a
+// Huffman stage the way zstd follows its matches with entropy coding. Gzip is
+// the DEFLATE of the standard library.
+const (
+	CodecNone = "none"
+	CodecGzip = "gzip"
+	CodecLZ   = "lz"
+	CodecLZH  = "lzh"
+)
+
+// Levels go from 1, the fastest, to 9, the smallest.
+const (
+	MinLevel = 1
+	MaxLevel = 9
+)
+
+var defaultLevels = map[string]int{
+	CodecGzip: 6,
+	CodecLZ:   1,
+	CodecLZH:  4,
+}
+
+var extensions = map[string]string{
+	CodecGzip: ".gz",
+	CodecLZ:   ".lz",
+	CodecLZH:  ".lzh",
+}
+
+// Compression is a codec and its level. The zero value compresses nothing.
+type Compression struct {
+	Codec string
+	Level int
+}
+
+// ParseCompression reads a codec with an optional level, e.g. "gzip" or
+// "lz:9". An empty string or "none" disables compression.
+func ParseCompression(s string) (Compression, error) {
+	codec, level, hasLevel := strings.Cut(s, ":")
+	if codec == "" || codec == CodecNone {
+		if hasLevel {
+			return Compression{}, fmt.Errorf("compression %q: %s takes no level", s, CodecNone)
+		}
+		return Compression{}, nil
+	}
+
+	compression := Compression{Codec: codec, Level: defaultLevels[codec]}
+	if _, ok := extensions[codec]; !ok {
+		return compression, fmt.Errorf("unknown compression codec %q", codec)
+	}
+
+	if hasLevel {
+		n, err := strconv.Atoi(level)
+		if err != nil || n < MinLevel || n > MaxLevel {
+			return compression, fmt.Errorf("compression %q: level must be between %d and %d", s, MinLevel, MaxLevel)
+		}
+		compression.Level = n
+	}
+
+	return compression, nil
+}
+
+func (c Compression) Enabled() bool {
+	return c.Codec != "" && c.Codec != CodecNone
+}
+
+// String is the form read by ParseCompression.
+func (c Compression) String() string {
+	if !c.Enabled() {
+		return CodecNone
+	}
+
+	return fmt.Sprintf("%s:%d", c.Codec, c.Level)
+}
+
+// Extension is appended to the name of the files it compresses.
+func (c Compression) Extension() string {
+	return extensions[c.Codec]
+}
+
+// NewWriter compresses what is written to it into w. Closing it does not
+// close w.
+func (c Compression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c.Codec {
+	case CodecGzip:
+		return gzip.NewWriterLevel(w, c.Level)
+	case CodecLZ:
+		return newLZWriter(w, c.Level), nil
+	case CodecLZH:
+		huffman, err := flate.NewWriter(w, flate.HuffmanOnly)
+		if err != nil {
+			return nil, err
+		}
+		return &chainedWriter{WriteCloser: newLZWriter(huffman, c.Level), next: huffman}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression codec %q", c.Codec)
+	}
+}
+
+// NewReader decompresses what is read from r.
+func (c Compression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	switch c.Codec {
+	case CodecGzip:
+		return gzip.NewReader(r)
+	case CodecLZ:
+		return io.NopCloser(newLZReader(r)), nil
+	case CodecLZH:
+		huffman := flate.NewReader(r)
+		return &chainedReader{Reader: newLZReader(huffman), next: huffman}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression codec %q", c.Codec)
+	}
+}
+
+// chainedWriter closes the next stage of a codec after the first one.
+type chainedWriter struct {
+	io.WriteCloser
+	next io.Closer
+}
+
+func (w *chainedWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+
+	return w.next.Close()
+}
+
+type chainedReader struct {
+	io.Reader
+	next io.Closer
+}
+
+func (r *chainedReader) Close() error {
+	return r.next.Close()
+}
+
+// CompressionResult is what compressing or decompressing a directory
+// measured. Manifest lists the compressed files with their sizes.
+type CompressionResult struct {
+	Compression     Compression
+	Files           int
+	RawBytes        int64
+	CompressedBytes int64
+	Elapsed         time.Duration
+	Manifest        control.Manifest
+}
+
+// Ratio is the raw size over the compressed size.
+func (r CompressionResult) Ratio() float64 {
+	if r.CompressedBytes == 0 {
+		return 0
+	}
+
+	return float64(r.RawBytes) / float64(r.CompressedBytes)
+}
+
+// CompressDirectory replaces every file below directory but the manifest file
+// with its compressed copy, named with the extension of the codec.
+func CompressDirectory(directory string, c Compression) (CompressionResult, error) {
+	result := CompressionResult{Compression: c}
+	start := time.Now()
+
+	paths, err := files(directory)
+	if err != nil {
+		return result, err
+	}
+
+	for _, path := range paths {
+		if path == control.ManifestFile {
+			continue
+		}
+
+		source := filepath.Join(directory, path)
+		raw, compressed, err := convertFile(source, source+c.Extension(), c.compress)
+		if err != nil {
+			return result, err
+		}
+
+		result.Files++
+		result.RawBytes += raw
+		result.CompressedBytes += compressed
+		result.Manifest = append(result.Manifest, control.ManifestEntry{Path: path + c.Extension(), Size: compressed})
+	}
+
+	result.Elapsed = time.Since(start)
+	return result, nil
+}
+
+// DecompressDirectory reverses CompressDirectory, replacing every file below
+// directory named with the extension of the codec with its content.
+func DecompressDirectory(directory string, c Compression) (CompressionResult, error) {
+	result := CompressionResult{Compression: c}
+	start := time.Now()
+
+	paths, err := files(directory)
+	if err != nil {
+		return result, err
+	}
+
+	for _, path := range paths {
+		if !strings.HasSuffix(path, c.Extension()) {
+			continue
+		}
+
+		source := filepath.Join(directory, path)
+		compressed, raw, err := convertFile(source, strings.TrimSuffix(source, c.Extension()), c.decompress)
+		if err != nil {
+			return result, fmt.Errorf("decompressing %s: %w", path, err)
+		}
+
+		result.Files++
+		result.RawBytes += raw
+		result.CompressedBytes += compressed
+	}
+
+	result.Elapsed = time.Since(start)
+	return result, nil
+}
+
+// compress writes r compressed to w.
+func (c Compression) compress(w io.Writer, r io.Reader) error {
+	writer, err := c.NewWriter(w)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(writer, r); err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// decompress writes r decompressed to w.
+func (c Compression) decompress(w io.Writer, r io.Reader) error {
+	reader, err := c.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+// convertFile writes source to destination through convert and removes
+// source. It returns the sizes of both.
+func convertFile(source string, destination string, convert func(io.Writer, io.Reader) error) (int64, int64, error) {
+	in, err := os.Open(source)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer out.Close()
+
+	read := &countingReader{reader: in}
+	written := &countingWriter{writer: out}
+
+	if err := convert(written, read); err != nil {
+		return read.count, written.count, err
+	}
+
+	if err := out.Close(); err != nil {
+		return read.count, written.count, err
+	}
+
+	return read.count, written.count, os.Remove(source)
+}
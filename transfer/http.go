@@ -0,0 +1,141 @@
+package transfer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/leonardopoggiani/lmo-performance-evaluation/control"
+)
+
+// UploadPath is where the receiver accepts HTTP uploads, followed by the name
+// of the directory.
+const UploadPath = "/archives/"
+
+var errUploadAborted = errors.New("upload aborted by the receiver")
+
+// HTTPUpload streams the archives as a tar archive in the body of a POST to
+// the receiver, without buffering them. The body crosses Link when set.
+type HTTPUpload struct {
+	Link *Link
+
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPUpload uploads to the receiver at address, e.g. the value of
+// RECEIVER_URL.
+func NewHTTPUpload(address string) *HTTPUpload {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	// No timeout: the upload lasts as long as the archives are large, the
+	// context bounds it.
+	return &HTTPUpload{baseURL: strings.TrimSuffix(address, "/"), client: &http.Client{}}
+}
+
+func (t *HTTPUpload) Name() string {
+	return HTTP
+}
+
+func (t *HTTPUpload) Send(ctx context.Context, directory string, name string) (Result, error) {
+	result := Result{Transport: HTTP, Link: t.Link}
+	start := time.Now()
+
+	reader, writer := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		link := t.Link.Writer(ctx, writer)
+		files, bytes, err := writeTar(link, directory)
+		if closeErr := link.Close(); err == nil {
+			err = closeErr
+		}
+		result.Files, result.Bytes = files, bytes
+		writer.CloseWithError(err)
+		written <- err
+	}()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, t.baseURL+UploadPath+url.PathEscape(name), reader)
+	if err != nil {
+		reader.Close()
+		<-written
+		return result, err
+	}
+	request.Header.Set("Content-Type", "application/x-tar")
+
+	response, err := t.client.Do(request)
+	if err != nil {
+		reader.CloseWithError(err)
+		<-written
+		return result, err
+	}
+	defer response.Body.Close()
+
+	receipt := Receipt{}
+	decodeErr := json.NewDecoder(response.Body).Decode(&receipt)
+	if decodeErr != nil || receipt.Error != "" {
+		// The receiver gave up early, the rest of the archive is not read.
+		reader.CloseWithError(errUploadAborted)
+	}
+	writeErr := <-written
+
+	if decodeErr != nil {
+		return result, fmt.Errorf("upload: unexpected status code %d: %w", response.StatusCode, decodeErr)
+	}
+
+	if receipt.Error != "" {
+		return result, fmt.Errorf("upload of %s refused: %s", name, receipt.Error)
+	}
+
+	if writeErr != nil {
+		return result, writeErr
+	}
+
+	result.Elapsed = time.Since(start)
+	return result, nil
+}
+
+// UploadHandler serves POST UploadPath{name}, extracting the uploaded tar
+// archive to the subdirectory name of root.
+func UploadHandler(root string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		receipt, status := receive(r.Body, root, strings.TrimPrefix(r.URL.Path, UploadPath))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(receipt)
+	})
+}
+
+// receive extracts a tar archive to the subdirectory name of root and returns
+// the receipt with the matching HTTP status.
+func receive(r io.Reader, root string, name string) (Receipt, int) {
+	receipt := Receipt{}
+
+	if !control.ValidDirectory(name) {
+		receipt.Error = fmt.Sprintf("invalid directory %q", name)
+		return receipt, http.StatusBadRequest
+	}
+
+	files, bytes, err := extractTar(r, filepath.Join(root, name))
+	receipt.Files, receipt.Bytes = files, bytes
+	if err != nil {
+		receipt.Error = err.Error()
+		return receipt, http.StatusInternalServerError
+	}
+
+	return receipt, http.StatusOK
+}
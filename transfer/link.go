@@ -0,0 +1,319 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Link emulates a slower network on the way from the sender to the receiver,
+// in process and without tc. Rate is in bytes per second, zero for no limit.
+// Every segment of the stream arrives Delay after it left, give or take up to
+// Jitter, and a segment is lost with probability Stall, holding back the
+// stream for StallTime as a retransmission timeout would. Segments never
+// overtake each other.
+type Link struct {
+	Rate      float64
+	Delay     time.Duration
+	Jitter    time.Duration
+	Stall     float64
+	StallTime time.Duration
+	Seed      int64
+}
+
+// linkSegment is the unit the link delays and stalls, a burst of packets.
+const linkSegment = 64 * 1024
+
+// linkWindow is how many segments can be in flight, enough to keep a
+// gigabit link with a hundred milliseconds of delay busy.
+const linkWindow = 256
+
+// DefaultStallTime is the stall of a lost segment unless configured otherwise,
+// the minimum retransmission timeout of Linux.
+const DefaultStallTime = 200 * time.Millisecond
+
+// Rate units, as accepted by tc: bits or bytes per second.
+var rateUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"gbit", 1e9 / 8}, {"mbit", 1e6 / 8}, {"kbit", 1e3 / 8}, {"bit", 1.0 / 8},
+	{"gbps", 1e9}, {"mbps", 1e6}, {"kbps", 1e3}, {"bps", 1},
+}
+
+// ParseLink reads a link profile, comma separated settings such as
+// "rate=100mbit,delay=20ms,jitter=5ms,stall=0.001,stall_time=300ms,seed=1".
+// Rates take the units of tc, a bare number being bytes per second. "none"
+// is no emulation and gives nil.
+func ParseLink(s string) (*Link, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "none" {
+		return nil, nil
+	}
+
+	link := &Link{StallTime: DefaultStallTime}
+
+	for _, setting := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(setting), "=")
+		if !ok {
+			return nil, fmt.Errorf("link %q: %q is not key=value", s, setting)
+		}
+
+		var err error
+		switch key {
+		case "rate":
+			link.Rate, err = parseRate(value)
+		case "delay":
+			link.Delay, err = parseLinkDuration(value)
+		case "jitter":
+			link.Jitter, err = parseLinkDuration(value)
+		case "stall":
+			link.Stall, err = strconv.ParseFloat(value, 64)
+			if err == nil && (link.Stall < 0 || link.Stall >= 1) {
+				err = fmt.Errorf("probability %v not in [0, 1)", link.Stall)
+			}
+		case "stall_time":
+			link.StallTime, err = parseLinkDuration(value)
+		case "seed":
+			link.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			err = fmt.Errorf("unknown setting")
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("link %q: %s: %w", s, key, err)
+		}
+	}
+
+	return link, nil
+}
+
+// ParseLinks reads link profiles separated by semicolons, e.g. to sweep the
+// bandwidth across trials. A "none" profile is nil.
+func ParseLinks(s string) ([]*Link, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var links []*Link
+	for _, profile := range strings.Split(s, ";") {
+		link, err := ParseLink(profile)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+func parseRate(s string) (float64, error) {
+	factor := 1.0
+	for _, unit := range rateUnits {
+		if strings.HasSuffix(strings.ToLower(s), unit.suffix) {
+			s, factor = s[:len(s)-len(unit.suffix)], unit.factor
+			break
+		}
+	}
+
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if rate < 0 {
+		return 0, fmt.Errorf("negative rate")
+	}
+
+	return rate * factor, nil
+}
+
+func parseLinkDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err == nil && d < 0 {
+		return 0, fmt.Errorf("negative duration")
+	}
+
+	return d, err
+}
+
+// String is the profile read by ParseLink, "none" for a nil link.
+func (l *Link) String() string {
+	if l == nil {
+		return "none"
+	}
+
+	var settings []string
+	if l.Rate > 0 {
+		settings = append(settings, fmt.Sprintf("rate=%smbit", strconv.FormatFloat(l.Rate*8/1e6, 'f', -1, 64)))
+	}
+	if l.Delay > 0 {
+		settings = append(settings, "delay="+l.Delay.String())
+	}
+	if l.Jitter > 0 {
+		settings = append(settings, "jitter="+l.Jitter.String())
+	}
+	if l.Stall > 0 {
+		settings = append(settings, fmt.Sprintf("stall=%v", l.Stall), "stall_time="+l.StallTime.String())
+	}
+	if l.Seed != 0 {
+		settings = append(settings, fmt.Sprintf("seed=%d", l.Seed))
+	}
+
+	if len(settings) == 0 {
+		return "none"
+	}
+
+	return strings.Join(settings, ",")
+}
+
+// Writer returns a writer that delivers to w what is written to it as the link
+// would. Close waits for the segments in flight and does not close w. A nil
+// link writes straight to w.
+func (l *Link) Writer(ctx context.Context, w io.Writer) io.WriteCloser {
+	if l == nil {
+		return nopCloser{w}
+	}
+
+	seed := l.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	writer := &linkWriter{
+		ctx:     ctx,
+		writer:  w,
+		link:    *l,
+		random:  rand.New(rand.NewSource(seed)),
+		start:   time.Now(),
+		queue:   make(chan segment, linkWindow),
+		stopped: make(chan struct{}),
+	}
+	go writer.deliver()
+
+	return writer
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+type segment struct {
+	data []byte
+	due  time.Time
+}
+
+// linkWriter sends the segments at the pace of the rate and delivers them to
+// the underlying writer from another goroutine once they are due, so that the
+// delay holds back each segment and not the whole stream. A stall, on the
+// contrary, holds back both: start, the clock of the departures, moves with it.
+type linkWriter struct {
+	ctx    context.Context
+	writer io.Writer
+	link   Link
+	random *rand.Rand
+	start  time.Time
+	sent   int64
+	last   time.Time
+
+	queue   chan segment
+	stopped chan struct{}
+	err     error
+	close   sync.Once
+}
+
+func (l *linkWriter) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		n := min(len(p), linkSegment)
+
+		// The segment leaves once the ones before it went through the rate.
+		l.sent += int64(n)
+		departure := time.Now()
+		if l.link.Rate > 0 {
+			departure = l.start.Add(time.Duration(float64(l.sent) / l.link.Rate * float64(time.Second)))
+			if err := sleepUntil(l.ctx, departure); err != nil {
+				return written, err
+			}
+		}
+
+		due := departure.Add(l.link.Delay)
+		if l.link.Jitter > 0 {
+			due = due.Add(time.Duration(l.random.Int63n(int64(2*l.link.Jitter+1))) - l.link.Jitter)
+		}
+		if due.Before(l.last) {
+			due = l.last
+		}
+
+		// A lost segment holds back the whole stream, the ones already in
+		// flight and the ones yet to leave, as TCP waits for the
+		// retransmission before going on.
+		if l.link.Stall > 0 && l.random.Float64() < l.link.Stall {
+			due = due.Add(l.link.StallTime)
+			l.start = l.start.Add(l.link.StallTime)
+		}
+		l.last = due
+
+		select {
+		case l.queue <- segment{data: append([]byte(nil), p[:n]...), due: due}:
+		case <-l.stopped:
+			return written, l.err
+		case <-l.ctx.Done():
+			return written, l.ctx.Err()
+		}
+
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+func (l *linkWriter) deliver() {
+	defer close(l.stopped)
+
+	for segment := range l.queue {
+		if err := sleepUntil(l.ctx, segment.due); err != nil {
+			l.err = err
+			return
+		}
+
+		if _, err := l.writer.Write(segment.data); err != nil {
+			l.err = err
+			return
+		}
+	}
+}
+
+func (l *linkWriter) Close() error {
+	l.close.Do(func() { close(l.queue) })
+	<-l.stopped
+	return l.err
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
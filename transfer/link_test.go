@@ -0,0 +1,144 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder keeps what the link delivers and when.
+type recorder struct {
+	mu        sync.Mutex
+	data      bytes.Buffer
+	delivered []time.Time
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.delivered = append(r.delivered, time.Now())
+	return r.data.Write(p)
+}
+
+// send writes data through link in writes of chunk bytes and returns the time
+// it took until Close returned.
+func send(t *testing.T, link Link, data []byte, chunk int) (*recorder, time.Duration) {
+	t.Helper()
+
+	r := &recorder{}
+	start := time.Now()
+
+	writer := link.Writer(context.Background(), r)
+	for rest := data; len(rest) > 0; {
+		n := min(len(rest), chunk)
+		if _, err := writer.Write(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return r, time.Since(start)
+}
+
+func TestLinkRate(t *testing.T) {
+	link := Link{Rate: 4 << 20, Seed: 1}
+	data := incompressible(1 << 20)
+
+	r, elapsed := send(t, link, data, 100000)
+
+	if !bytes.Equal(r.data.Bytes(), data) {
+		t.Fatal("delivered data differs from the data sent")
+	}
+
+	// 1 MiB at 4 MiB/s, the first segment leaving after its own share.
+	if want := 250 * time.Millisecond; elapsed < want || elapsed > want+250*time.Millisecond {
+		t.Fatalf("took %v, want about %v", elapsed, want)
+	}
+}
+
+func TestLinkOrder(t *testing.T) {
+	// The jitter is larger than the time between two segments, so that
+	// without the clamping later segments would be due first.
+	link := Link{Rate: 16 << 20, Delay: 10 * time.Millisecond, Jitter: 10 * time.Millisecond, Seed: 3}
+	data := incompressible(40 * linkSegment)
+
+	r, _ := send(t, link, data, 3*linkSegment/2)
+
+	if !bytes.Equal(r.data.Bytes(), data) {
+		t.Fatal("delivered data differs from the data sent")
+	}
+
+	for i := 1; i < len(r.delivered); i++ {
+		if r.delivered[i].Before(r.delivered[i-1]) {
+			t.Fatalf("segment %d delivered before segment %d", i, i-1)
+		}
+	}
+}
+
+func TestLinkStallsAddUp(t *testing.T) {
+	const segments = 5
+	stall := 30 * time.Millisecond
+
+	tests := []struct {
+		name string
+		link Link
+		want time.Duration
+	}{
+		// Nearly every segment stalls: the stalls follow one another
+		// instead of overlapping.
+		{"no rate", Link{Stall: 0.999, StallTime: stall, Seed: 1}, segments * stall},
+		// The segments still to leave are held back as well.
+		{"rate", Link{Rate: 10 * linkSegment, Stall: 0.999, StallTime: stall, Seed: 1}, segments*stall + 500*time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, elapsed := send(t, test.link, incompressible(segments*linkSegment), linkSegment)
+
+			if elapsed < test.want || elapsed > test.want+250*time.Millisecond {
+				t.Fatalf("took %v, want about %v", elapsed, test.want)
+			}
+		})
+	}
+}
+
+func TestParseLink(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    *Link
+	}{
+		{"none", nil},
+		{"", nil},
+		{"rate=100mbit", &Link{Rate: 12.5e6, StallTime: DefaultStallTime}},
+		{"rate=2mbps,delay=20ms,jitter=5ms", &Link{Rate: 2e6, Delay: 20 * time.Millisecond, Jitter: 5 * time.Millisecond, StallTime: DefaultStallTime}},
+		{"stall=0.01,stall_time=300ms,seed=7", &Link{Stall: 0.01, StallTime: 300 * time.Millisecond, Seed: 7}},
+	}
+
+	for _, test := range tests {
+		got, err := ParseLink(test.profile)
+		if err != nil {
+			t.Fatalf("%q: %v", test.profile, err)
+		}
+
+		if (got == nil) != (test.want == nil) || (got != nil && *got != *test.want) {
+			t.Fatalf("%q: got %+v, want %+v", test.profile, got, test.want)
+		}
+
+		if again, err := ParseLink(got.String()); err != nil || (again == nil) != (got == nil) || (again != nil && *again != *got) {
+			t.Fatalf("%q: %q does not parse back: %+v, %v", test.profile, got.String(), again, err)
+		}
+	}
+
+	for _, profile := range []string{"rate", "rate=-1", "delay=-5ms", "stall=1", "bandwidth=1mbit"} {
+		if _, err := ParseLink(profile); err == nil {
+			t.Fatalf("%q: no error", profile)
+		}
+	}
+}
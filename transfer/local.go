@@ -0,0 +1,76 @@
+package transfer
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LocalCopy copies the archives to Root, a path shared with the receiver,
+// e.g. an NFS mount of its checkpoint root. Each file crosses Link, when set,
+// on its own.
+type LocalCopy struct {
+	Root string
+	Link *Link
+}
+
+func (t LocalCopy) Name() string {
+	return Local
+}
+
+func (t LocalCopy) Send(ctx context.Context, directory string, name string) (Result, error) {
+	result := Result{Transport: Local, Link: t.Link}
+	start := time.Now()
+
+	paths, err := files(directory)
+	if err != nil {
+		return result, err
+	}
+
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		written, err := t.copyFile(ctx, filepath.Join(directory, path), filepath.Join(t.Root, name, path))
+		result.Bytes += written
+		if err != nil {
+			return result, err
+		}
+		result.Files++
+	}
+
+	result.Elapsed = time.Since(start)
+	return result, nil
+}
+
+func (t LocalCopy) copyFile(ctx context.Context, source string, destination string) (int64, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return 0, err
+	}
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	link := t.Link.Writer(ctx, out)
+	written, err := io.Copy(link, file)
+	if closeErr := link.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return written, err
+	}
+
+	return written, out.Close()
+}
@@ -0,0 +1,389 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// The lz codec is modelled on the LZ4 block format: every sequence is a token
+// holding the literal and match lengths, the literals, and a two-byte offset
+// into the last 64 KiB. There is no entropy coding, so it is fast on both
+// sides with a modest ratio. The stream is a series of blocks, each prefixed
+// with its raw and compressed lengths as uvarints, ended by a zero raw length.
+const (
+	lzBlockSize = 1 << 20
+	lzMinMatch  = 4
+	lzMaxOffset = 1<<16 - 1
+	lzHashBits  = 16
+)
+
+var errCorruptLZ = errors.New("lz: corrupt stream")
+
+// lzDepth is how many earlier positions with the same hash are tried for a
+// match at level, 1 to 9.
+func lzDepth(level int) int {
+	return 1 << (level - 1)
+}
+
+func lzHash(b []byte) uint32 {
+	return binary.LittleEndian.Uint32(b) * 2654435761 >> (32 - lzHashBits)
+}
+
+func appendLZLength(dst []byte, n int) []byte {
+	for n >= 255 {
+		dst = append(dst, 255)
+		n -= 255
+	}
+
+	return append(dst, byte(n))
+}
+
+// appendLZSequence appends the literals followed by a match, or by nothing
+// when length is zero, which only the last sequence of a block does.
+func appendLZSequence(dst []byte, literals []byte, length int, offset int) []byte {
+	token := byte(min(len(literals), 15) << 4)
+	if length > 0 {
+		token |= byte(min(length-lzMinMatch, 15))
+	}
+
+	dst = append(dst, token)
+	if len(literals) >= 15 {
+		dst = appendLZLength(dst, len(literals)-15)
+	}
+	dst = append(dst, literals...)
+
+	if length == 0 {
+		return dst
+	}
+
+	dst = append(dst, byte(offset), byte(offset>>8))
+	if length-lzMinMatch >= 15 {
+		dst = appendLZLength(dst, length-lzMinMatch-15)
+	}
+
+	return dst
+}
+
+// lzMatcher finds earlier occurrences of the bytes at a position of a block.
+// Its tables are kept from one block to the next.
+type lzMatcher struct {
+	depth int
+	head  []int32
+	prev  []int32
+}
+
+func newLZMatcher(level int) *lzMatcher {
+	m := &lzMatcher{depth: lzDepth(level), head: make([]int32, 1<<lzHashBits)}
+	if m.depth > 1 {
+		m.prev = make([]int32, lzBlockSize)
+	}
+
+	return m
+}
+
+func (m *lzMatcher) insert(src []byte, i int) {
+	h := lzHash(src[i:])
+	if m.prev != nil {
+		m.prev[i] = m.head[h]
+	}
+	m.head[h] = int32(i)
+}
+
+// find returns the longest match for position i within depth candidates.
+func (m *lzMatcher) find(src []byte, i int) (int, int) {
+	length, offset := 0, 0
+
+	candidate := m.head[lzHash(src[i:])]
+	for tries := 0; tries < m.depth && candidate >= 0 && i-int(candidate) <= lzMaxOffset; tries++ {
+		c := int(candidate)
+
+		if n := matchLength(src, c, i); n > length {
+			length, offset = n, i-c
+		}
+
+		if m.prev == nil {
+			break
+		}
+		candidate = m.prev[c]
+	}
+
+	return length, offset
+}
+
+// matchLength counts the bytes from c and i that are equal, a word at a time.
+func matchLength(src []byte, c int, i int) int {
+	n := 0
+	for i+n+8 <= len(src) {
+		diff := binary.LittleEndian.Uint64(src[c+n:]) ^ binary.LittleEndian.Uint64(src[i+n:])
+		if diff != 0 {
+			return n + bits.TrailingZeros64(diff)/8
+		}
+		n += 8
+	}
+
+	for i+n < len(src) && src[c+n] == src[i+n] {
+		n++
+	}
+
+	return n
+}
+
+// compress appends the compressed src to dst.
+func (m *lzMatcher) compress(dst []byte, src []byte) []byte {
+	for i := range m.head {
+		m.head[i] = -1
+	}
+
+	anchor := 0
+	for i := 0; i+lzMinMatch <= len(src); {
+		length, offset := m.find(src, i)
+		m.insert(src, i)
+
+		if length < lzMinMatch {
+			// Like LZ4, the fastest level skips faster through data that
+			// does not compress.
+			i++
+			if m.prev == nil {
+				i += (i - anchor) >> 6
+			}
+			continue
+		}
+
+		dst = appendLZSequence(dst, src[anchor:i], length, offset)
+
+		// Deeper searches need the positions inside the match too.
+		if m.prev != nil {
+			for j := i + 1; j < i+length && j+lzMinMatch <= len(src); j++ {
+				m.insert(src, j)
+			}
+		}
+
+		i += length
+		anchor = i
+	}
+
+	return appendLZSequence(dst, src[anchor:], 0, 0)
+}
+
+func readLZLength(src []byte, i int) (int, int, error) {
+	n := 0
+	for {
+		if i >= len(src) {
+			return 0, i, errCorruptLZ
+		}
+
+		b := src[i]
+		i++
+		n += int(b)
+		if b != 255 {
+			return n, i, nil
+		}
+	}
+}
+
+// lzDecompress appends the decompressed block src to dst, which must be
+// empty since offsets never reach past the start of the block.
+func lzDecompress(dst []byte, src []byte) ([]byte, error) {
+	var err error
+
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+
+		literals := int(token >> 4)
+		if literals == 15 {
+			var n int
+			if n, i, err = readLZLength(src, i); err != nil {
+				return nil, err
+			}
+			literals += n
+		}
+
+		if i+literals > len(src) {
+			return nil, errCorruptLZ
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+
+		if i == len(src) {
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, errCorruptLZ
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+
+		length := int(token & 15)
+		if length == 15 {
+			var n int
+			if n, i, err = readLZLength(src, i); err != nil {
+				return nil, err
+			}
+			length += n
+		}
+		length += lzMinMatch
+
+		if offset == 0 || offset > len(dst) {
+			return nil, errCorruptLZ
+		}
+
+		// The match may overlap the bytes it produces.
+		start := len(dst) - offset
+		if offset >= length {
+			dst = append(dst, dst[start:start+length]...)
+			continue
+		}
+		for k := 0; k < length; k++ {
+			dst = append(dst, dst[start+k])
+		}
+	}
+
+	return dst, nil
+}
+
+// lzWriter compresses what is written to it, a block at a time.
+type lzWriter struct {
+	writer  io.Writer
+	matcher *lzMatcher
+	block   []byte
+	out     []byte
+}
+
+func newLZWriter(w io.Writer, level int) *lzWriter {
+	return &lzWriter{writer: w, matcher: newLZMatcher(level), block: make([]byte, 0, lzBlockSize)}
+}
+
+func (z *lzWriter) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		n := min(len(p), lzBlockSize-len(z.block))
+		z.block = append(z.block, p[:n]...)
+		p = p[n:]
+		written += n
+
+		if len(z.block) == lzBlockSize {
+			if err := z.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+func (z *lzWriter) flush() error {
+	if len(z.block) == 0 {
+		return nil
+	}
+
+	z.out = z.matcher.compress(z.out[:0], z.block)
+
+	header := binary.AppendUvarint(nil, uint64(len(z.block)))
+	header = binary.AppendUvarint(header, uint64(len(z.out)))
+	z.block = z.block[:0]
+
+	if _, err := z.writer.Write(header); err != nil {
+		return err
+	}
+
+	_, err := z.writer.Write(z.out)
+	return err
+}
+
+// Close writes the last block and the end of the stream. It does not close the
+// underlying writer.
+func (z *lzWriter) Close() error {
+	if err := z.flush(); err != nil {
+		return err
+	}
+
+	_, err := z.writer.Write([]byte{0})
+	return err
+}
+
+// lzReader decompresses a stream written by lzWriter.
+type lzReader struct {
+	reader *bufio.Reader
+	block  []byte
+	pos    int
+	err    error
+}
+
+func newLZReader(r io.Reader) *lzReader {
+	return &lzReader{reader: bufio.NewReader(r)}
+}
+
+func (z *lzReader) Read(p []byte) (int, error) {
+	for z.pos == len(z.block) {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.next()
+	}
+
+	n := copy(p, z.block[z.pos:])
+	z.pos += n
+	return n, nil
+}
+
+// next loads the next block, io.EOF at the end of the stream.
+func (z *lzReader) next() error {
+	raw, err := binary.ReadUvarint(z.reader)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	// The end of the stream must be the end of the input, which also makes
+	// the next stage of lzh check its own end.
+	if raw == 0 {
+		_, err := z.reader.ReadByte()
+		if err == nil {
+			return errCorruptLZ
+		}
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+		return io.EOF
+	}
+
+	size, err := binary.ReadUvarint(z.reader)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	// A block never grows past its worst case, all literals.
+	if raw > lzBlockSize || size > lzBlockSize+lzBlockSize/255+16 {
+		return errCorruptLZ
+	}
+
+	compressed := make([]byte, size)
+	if _, err := io.ReadFull(z.reader, compressed); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	block, err := lzDecompress(make([]byte, 0, raw), compressed)
+	if err != nil {
+		return err
+	}
+
+	if len(block) != int(raw) {
+		return errCorruptLZ
+	}
+
+	z.block, z.pos = block, 0
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,218 @@
+package transfer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// compressible is text with repeats near and far, past the 64 KiB window.
+func compressible(n int) []byte {
+	random := rand.New(rand.NewSource(1))
+	words := []string{"checkpoint", "restore", "container", "pod", "migration", "archive", "\n", " ", "{", "}"}
+
+	var b bytes.Buffer
+	for b.Len() < n {
+		b.WriteString(words[random.Intn(len(words))])
+		if random.Intn(64) == 0 {
+			b.Write(bytes.Repeat([]byte{byte(random.Intn(256))}, random.Intn(600)))
+		}
+	}
+
+	return b.Bytes()[:n]
+}
+
+func incompressible(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(2)).Read(data)
+	return data
+}
+
+func roundTripInputs() map[string][]byte {
+	inputs := map[string][]byte{
+		"empty":              nil,
+		"one byte":           {42},
+		"below min match":    []byte("abc"),
+		"run":                bytes.Repeat([]byte{'a'}, 100000),
+		"period two":         bytes.Repeat([]byte("ab"), 50000),
+		"text":               compressible(300000),
+		"random":             incompressible(100000),
+		"block":              compressible(lzBlockSize),
+		"block minus one":    compressible(lzBlockSize - 1),
+		"block plus one":     compressible(lzBlockSize + 1),
+		"two blocks plus":    compressible(2*lzBlockSize + 17),
+		"random block plus":  incompressible(lzBlockSize + 1),
+		"zeros block plus":   make([]byte, lzBlockSize+1),
+		"random then repeat": append(incompressible(70000), incompressible(70000)...),
+	}
+
+	return inputs
+}
+
+func roundTrip(t *testing.T, compression Compression, data []byte) {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	writer, err := compression.NewWriter(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Odd write sizes cross the block boundaries at every offset.
+	for rest := data; len(rest) > 0; {
+		n := min(len(rest), 300007)
+		if _, err := writer.Write(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := compression.NewReader(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decompressed, data) {
+		t.Fatalf("%d bytes decompressed, %d expected, not equal", len(decompressed), len(data))
+	}
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	inputs := roundTripInputs()
+
+	for _, codec := range []string{CodecGzip, CodecLZ, CodecLZH} {
+		for level := MinLevel; level <= MaxLevel; level++ {
+			compression := Compression{Codec: codec, Level: level}
+
+			for name, data := range inputs {
+				t.Run(fmt.Sprintf("%s/%s", compression, name), func(t *testing.T) {
+					roundTrip(t, compression, data)
+				})
+			}
+		}
+	}
+}
+
+func TestLZOverlappingMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		block []byte
+		want  string
+	}{
+		// "abc", then 20 bytes from offset 1: the length goes past 15.
+		{"offset 1", []byte{0x3f, 'a', 'b', 'c', 1, 0, 1}, "abc" + string(bytes.Repeat([]byte{'c'}, 20))},
+		// "abc", then 10 bytes from offset 3.
+		{"offset 3", []byte{0x36, 'a', 'b', 'c', 3, 0}, "abcabcabcabca"},
+		// A match followed by trailing literals.
+		{"trailing literals", []byte{0x20, 'x', 'y', 2, 0, 0x10, 'z'}, "xyxyxyz"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := lzDecompress(nil, test.block)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLZCorruptBlock(t *testing.T) {
+	blocks := map[string][]byte{
+		"offset zero":         {0x10, 'a', 0, 0},
+		"offset before start": {0x10, 'a', 2, 0},
+		"missing literals":    {0x50, 'a', 'b'},
+		"missing offset":      {0x10, 'a', 1},
+		"missing length":      {0x1f, 'a', 1, 0},
+		"missing literal len": {0xf0},
+	}
+
+	for name, block := range blocks {
+		t.Run(name, func(t *testing.T) {
+			if _, err := lzDecompress(nil, block); err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+}
+
+func TestTruncatedStream(t *testing.T) {
+	data := compressible(lzBlockSize + 1000)
+
+	for _, codec := range []string{CodecGzip, CodecLZ, CodecLZH} {
+		compression := Compression{Codec: codec, Level: defaultLevels[codec]}
+
+		t.Run(codec, func(t *testing.T) {
+			var compressed bytes.Buffer
+			writer, err := compression.NewWriter(&compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := writer.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			stream := compressed.Bytes()
+			for _, n := range []int{0, 1, 2, 5, len(stream) / 3, len(stream) / 2, len(stream) - 2, len(stream) - 1} {
+				reader, err := compression.NewReader(bytes.NewReader(stream[:n]))
+				if err != nil {
+					continue
+				}
+
+				if _, err := io.ReadAll(reader); err == nil {
+					t.Errorf("stream cut at %d of %d bytes read without error", n, len(stream))
+				}
+				reader.Close()
+			}
+		})
+	}
+}
+
+func FuzzLZDecompress(f *testing.F) {
+	for _, data := range [][]byte{nil, []byte("abc"), bytes.Repeat([]byte("ab"), 100), compressible(5000)} {
+		f.Add(newLZMatcher(4).compress(nil, data))
+
+		var stream bytes.Buffer
+		writer := newLZWriter(&stream, 4)
+		writer.Write(data)
+		writer.Close()
+		f.Add(stream.Bytes())
+	}
+	f.Add([]byte{0x3f, 'a', 'b', 'c', 1, 0, 1})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if block, err := lzDecompress(nil, data); err == nil {
+			// A valid block decompresses the same from within a stream.
+			var stream bytes.Buffer
+			writer := newLZWriter(&stream, 1)
+			writer.Write(block)
+			writer.Close()
+
+			again, err := io.ReadAll(newLZReader(&stream))
+			if err != nil || !bytes.Equal(again, block) {
+				t.Fatalf("round trip of a decompressed block: %v", err)
+			}
+		}
+
+		io.ReadAll(newLZReader(bytes.NewReader(data)))
+	})
+}
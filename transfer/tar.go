@@ -0,0 +1,135 @@
+package transfer
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// writeTar streams the files below directory as a tar archive to w, in the
+// order of files. It returns how many files and bytes were written.
+func writeTar(w io.Writer, directory string) (int, int64, error) {
+	paths, err := files(directory)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	counter := &countingWriter{writer: w}
+	archive := tar.NewWriter(counter)
+
+	for _, path := range paths {
+		if err := addFile(archive, directory, path); err != nil {
+			return 0, counter.count, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return len(paths), counter.count, err
+	}
+
+	return len(paths), counter.count, nil
+}
+
+func addFile(archive *tar.Writer, directory string, path string) error {
+	file, err := os.Open(filepath.Join(directory, path))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(path)
+
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(archive, file)
+	return err
+}
+
+// extractTar writes the regular files of the tar archive read from r below
+// directory. Entries that would land outside of directory are refused. It
+// returns how many files and bytes were read.
+func extractTar(r io.Reader, directory string) (int, int64, error) {
+	counter := &countingReader{reader: r}
+	archive := tar.NewReader(counter)
+	count := 0
+
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return count, counter.count, nil
+		}
+		if err != nil {
+			return count, counter.count, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		path := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(path) {
+			return count, counter.count, fmt.Errorf("refusing archive entry %q", header.Name)
+		}
+
+		if err := writeFile(filepath.Join(directory, path), archive); err != nil {
+			return count, counter.count, err
+		}
+		count++
+	}
+}
+
+func writeFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,115 @@
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// TarTCP streams the archives as a tar archive over a TCP connection to the
+// receiver. The name of the directory goes first, on a line of its own, and
+// the receiver answers with a JSON Receipt once the archive is extracted. The
+// stream crosses Link when set.
+type TarTCP struct {
+	Address string
+	Link    *Link
+}
+
+func (t TarTCP) Name() string {
+	return TCP
+}
+
+func (t TarTCP) Send(ctx context.Context, directory string, name string) (Result, error) {
+	result := Result{Transport: TCP, Link: t.Link}
+	start := time.Now()
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", t.Address)
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+
+	// Closing the connection unblocks the writes when the context is done.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	link := t.Link.Writer(ctx, conn)
+	defer link.Close()
+
+	if _, err := fmt.Fprintf(link, "%s\n", name); err != nil {
+		return result, err
+	}
+
+	result.Files, result.Bytes, err = writeTar(link, directory)
+	if err != nil {
+		return result, err
+	}
+
+	if err := link.Close(); err != nil {
+		return result, err
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		if err := tcp.CloseWrite(); err != nil {
+			return result, err
+		}
+	}
+
+	receipt := Receipt{}
+	if err := json.NewDecoder(conn).Decode(&receipt); err != nil {
+		return result, fmt.Errorf("tcp transfer: no receipt: %w", err)
+	}
+
+	if receipt.Error != "" {
+		return result, fmt.Errorf("tcp transfer of %s refused: %s", name, receipt.Error)
+	}
+
+	result.Elapsed = time.Since(start)
+	return result, nil
+}
+
+// ServeTCP accepts tar-over-TCP transfers on address and extracts them below
+// root until the context is canceled. Each connection carries one transfer.
+func ServeTCP(ctx context.Context, address string, root string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stop()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		go serveConn(conn, root)
+	}
+}
+
+func serveConn(conn net.Conn, root string) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	receipt := Receipt{}
+	name, err := reader.ReadString('\n')
+	if err != nil {
+		receipt.Error = fmt.Sprintf("reading the directory: %v", err)
+	} else {
+		receipt, _ = receive(reader, root, strings.TrimSuffix(name, "\n"))
+	}
+
+	json.NewEncoder(conn).Encode(receipt)
+}
@@ -0,0 +1,145 @@
+// Package transfer moves the checkpoint archives of a migration from the
+// sender to the receiver without going through the operator: by copying them
+// to a path shared with the receiver, by streaming them as a tar archive in an
+// HTTP upload, or as a tar archive over a plain TCP connection. Every transport
+// reports how many bytes it moved and how long it took, so that the transport
+// can be told apart from the rest of the migration. The archives may be
+// compressed before they are sent and decompressed once received, see
+// Compression, and sent through an emulated link, see Link.
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/leonardopoggiani/lmo-performance-evaluation/control"
+)
+
+// Names of the transports. Operator is the MigrateCheckpoint of the operator,
+// which lives outside of this package.
+const (
+	Operator = "operator"
+	Local    = "local"
+	HTTP     = "http"
+	TCP      = "tcp"
+)
+
+// DefaultListen is the address the receiver accepts tar-over-TCP transfers on
+// unless configured otherwise.
+const DefaultListen = ":8090"
+
+// Transport moves the content of a checkpoint directory to the receiver.
+type Transport interface {
+	Name() string
+	// Send copies every file below directory to the subdirectory name of the
+	// checkpoint root of the receiver. The manifest file goes last, so that
+	// the receiver only finds it once the archives are complete.
+	Send(ctx context.Context, directory string, name string) (Result, error)
+}
+
+// Result is what a transport measured. Bytes counts what went through the
+// transport, tar headers included where there are any. Link is the emulated
+// link the bytes crossed, nil for the network as it is.
+type Result struct {
+	Transport string
+	Link      *Link
+	Files     int
+	Bytes     int64
+	Elapsed   time.Duration
+}
+
+// Emulate returns a copy of transport that sends through link. The operator
+// moves the archives outside of this package and cannot be emulated.
+func Emulate(transport Transport, link *Link) (Transport, error) {
+	switch t := transport.(type) {
+	case LocalCopy:
+		t.Link = link
+		return t, nil
+	case TarTCP:
+		t.Link = link
+		return t, nil
+	case *HTTPUpload:
+		emulated := *t
+		emulated.Link = link
+		return &emulated, nil
+	default:
+		return nil, fmt.Errorf("the %s transport cannot be emulated", transport.Name())
+	}
+}
+
+// Throughput is in bytes per second.
+func (r Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(r.Bytes) / r.Elapsed.Seconds()
+}
+
+// Receipt is the answer of the receiver to an HTTP or TCP transfer.
+type Receipt struct {
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+	Error string `json:"error,omitempty"`
+}
+
+// files lists the regular files below directory, relative to it, in path
+// order with the manifest file last.
+func files(directory string) ([]string, error) {
+	var paths []string
+
+	err := filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		relative, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+
+		paths = append(paths, relative)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		if (paths[i] == control.ManifestFile) != (paths[j] == control.ManifestFile) {
+			return paths[j] == control.ManifestFile
+		}
+
+		return paths[i] < paths[j]
+	})
+
+	return paths, nil
+}
+
+// DirectorySize counts the regular files below directory and their bytes.
+func DirectorySize(directory string) (int, int64, error) {
+	paths, err := files(directory)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var size int64
+	for _, path := range paths {
+		info, err := os.Stat(filepath.Join(directory, path))
+		if err != nil {
+			return 0, 0, err
+		}
+		size += info.Size()
+	}
+
+	return len(paths), size, nil
+}